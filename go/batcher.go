@@ -0,0 +1,352 @@
+package devlogs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batcher buffers documents and sends them to OpenSearch with the _bulk API.
+//
+// A batch is flushed when it reaches maxSize items, when adding a document
+// would push it past maxBytes of encoded payload, when flushInterval elapses, or
+// when its oldest document has been buffered for maxAge. A zero value disables
+// that trigger.
+type batcher struct {
+	client        *Client
+	maxSize       int
+	maxBytes      int
+	flushInterval time.Duration
+	// onResult receives the outcome of each bulk request and the distinct
+	// indices of its items ("" for the client's index)
+	onResult func(indices []string, err error)
+
+	// ctx is used for bulk requests; canceling it aborts in-flight sends
+	ctx context.Context
+
+	// sem limits concurrent bulk requests (nil is unlimited)
+	sem chan struct{}
+
+	// indices creates missing indices before sending (nil disables)
+	indices *indexCache
+
+	// maxAge bounds how long the oldest buffered document waits (0 disables)
+	maxAge time.Duration
+
+	// retry re-sends bulk requests after transient failures (nil disables)
+	retry *retryPolicy
+
+	// onFailedItems receives the items rejected by a partially failed bulk request (nil ignores them)
+	onFailedItems func(failed []FailedItem)
+
+	// ordered sends batches one at a time in flush order (see WithBulkOrdering)
+	ordered bool
+	// lastSent is closed when the most recently flushed batch is done (ordered only)
+	lastSent chan struct{}
+
+	// stampIngest sets ingest_timestamp on documents when their bulk request is sent
+	stampIngest bool
+
+	mu       sync.Mutex
+	items    []batchItem
+	bytes    int
+	firstAt  time.Time
+	ageTimer *time.Timer
+
+	// buffered mirrors len(items) so depth can be read without the lock
+	buffered atomic.Int64
+
+	// lastReason is the FlushReason of the most recent non-empty flush
+	lastReason atomic.Int32
+
+	wg       sync.WaitGroup
+	inflight atomic.Int64
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// FlushReason is the trigger that sent a batch (see Handler.LastFlushReason).
+type FlushReason int32
+
+const (
+	// FlushReasonNone means no batch has been sent yet.
+	FlushReasonNone FlushReason = iota
+	// FlushReasonCount means the batch reached its maximum record count.
+	FlushReasonCount
+	// FlushReasonBytes means the next record would have exceeded the byte limit.
+	FlushReasonBytes
+	// FlushReasonInterval means the flush interval elapsed.
+	FlushReasonInterval
+	// FlushReasonAge means the oldest record reached the maximum batch age.
+	FlushReasonAge
+	// FlushReasonLevel means a record at the WithFlushOnLevel level arrived.
+	FlushReasonLevel
+	// FlushReasonManual means Flush or Close was called.
+	FlushReasonManual
+)
+
+// String returns the reason's name, e.g. "count" or "interval".
+func (r FlushReason) String() string {
+	switch r {
+	case FlushReasonCount:
+		return "count"
+	case FlushReasonBytes:
+		return "bytes"
+	case FlushReasonInterval:
+		return "interval"
+	case FlushReasonAge:
+		return "age"
+	case FlushReasonLevel:
+		return "level"
+	case FlushReasonManual:
+		return "manual"
+	default:
+		return "none"
+	}
+}
+
+// batchItem is a buffered document and its encoded bulk lines.
+type batchItem struct {
+	item BulkItem
+	line []byte
+}
+
+// ingestStampSize approximates the bytes ingest_timestamp adds to a document.
+var ingestStampSize = len(`,"ingest_timestamp":"2006-01-02T15:04:05.000Z"`)
+
+// newBatcher creates a batcher and starts its interval flusher.
+func newBatcher(client *Client, maxSize, maxBytes int, flushInterval time.Duration, onResult func(indices []string, err error)) *batcher {
+	b := &batcher{
+		client:        client,
+		maxSize:       maxSize,
+		maxBytes:      maxBytes,
+		flushInterval: flushInterval,
+		onResult:      onResult,
+		stopCh:        make(chan struct{}),
+		ctx:           context.Background(),
+	}
+	if flushInterval > 0 {
+		go b.run()
+	}
+	return b
+}
+
+// add encodes a document and appends it to the current batch.
+func (b *batcher) add(item BulkItem) error {
+	line, err := b.client.encodeBulkItem(item)
+	if err != nil {
+		return err
+	}
+
+	size := len(line)
+	if b.stampIngest {
+		size += ingestStampSize
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Flush first if this document would push the batch over the byte budget
+	if b.maxBytes > 0 && len(b.items) > 0 && b.bytes+size > b.maxBytes {
+		b.flushLocked(FlushReasonBytes)
+	}
+
+	if len(b.items) == 0 && b.maxAge > 0 {
+		b.firstAt = time.Now()
+		b.ageTimer = time.AfterFunc(b.maxAge, b.flushAged)
+	}
+	b.items = append(b.items, batchItem{item: item, line: line})
+	b.bytes += size
+	b.buffered.Add(1)
+
+	if b.maxSize > 0 && len(b.items) >= b.maxSize {
+		b.flushLocked(FlushReasonCount)
+	}
+	return nil
+}
+
+// flushLocked hands the current batch to a sender goroutine. Caller holds b.mu.
+func (b *batcher) flushLocked(reason FlushReason) {
+	if len(b.items) == 0 {
+		return
+	}
+	b.lastReason.Store(int32(reason))
+	items := b.items
+	b.items = nil
+	b.bytes = 0
+	if b.ageTimer != nil {
+		b.ageTimer.Stop()
+		b.ageTimer = nil
+	}
+
+	// In ordered mode each batch waits for the one flushed before it, including
+	// that batch's retries
+	var prev, done chan struct{}
+	if b.ordered {
+		prev, done = b.lastSent, make(chan struct{})
+		b.lastSent = done
+	}
+
+	b.wg.Add(1)
+	b.inflight.Add(int64(len(items)))
+	b.buffered.Add(-int64(len(items)))
+	go func() {
+		defer b.wg.Done()
+		defer b.inflight.Add(-int64(len(items)))
+		if done != nil {
+			defer close(done)
+		}
+		if prev != nil {
+			<-prev
+		}
+		if b.sem != nil {
+			b.sem <- struct{}{}
+			defer func() { <-b.sem }()
+		}
+		b.send(items)
+	}()
+}
+
+// flushAged flushes the batch once its oldest document reaches maxAge.
+func (b *batcher) flushAged() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// A timer from an already-flushed batch may fire late; only flush if the
+	// current batch is old enough
+	if len(b.items) > 0 && time.Since(b.firstAt) >= b.maxAge {
+		b.flushLocked(FlushReasonAge)
+	}
+}
+
+// send writes one bulk request for the given items.
+func (b *batcher) send(items []batchItem) {
+	var body bytes.Buffer
+	for _, bi := range items {
+		line := bi.line
+		if doc, ok := bi.item.Document.(*LogDocument); ok && b.stampIngest {
+			doc.stampIngestTime()
+			if encoded, err := b.client.encodeBulkItem(bi.item); err == nil {
+				line = encoded
+			}
+		}
+		body.Write(line)
+	}
+	var failures []bulkFailure
+	err := b.ensureIndices(items)
+	if err == nil {
+		send := func() error {
+			var sendErr error
+			failures, sendErr = b.client.sendBulk(b.ctx, body.Bytes())
+			return sendErr
+		}
+		if b.retry != nil {
+			err = b.retry.do(b.ctx, send)
+		} else {
+			err = send()
+		}
+	}
+	if len(failures) > 0 && b.onFailedItems != nil {
+		failed := make([]FailedItem, 0, len(failures))
+		for _, f := range failures {
+			if f.pos < len(items) {
+				failed = append(failed, FailedItem{Item: items[f.pos].item, Status: f.status, Reason: f.reason})
+			}
+		}
+		if len(failed) > 0 {
+			b.onFailedItems(failed)
+		}
+	}
+	var notFound *IndexNotFoundError
+	if b.indices != nil && errors.As(err, &notFound) {
+		for _, bi := range items {
+			b.indices.invalidate(bi.item.Index)
+		}
+	}
+	if b.onResult != nil {
+		if len(failures) > 0 {
+			// The request itself succeeded; rejected items are not an outage
+			err = nil
+		}
+		b.onResult(batchIndices(items), err)
+	}
+}
+
+// batchIndices returns the distinct target indices of items, in order.
+func batchIndices(items []batchItem) []string {
+	var indices []string
+	seen := make(map[string]bool)
+	for _, bi := range items {
+		if !seen[bi.item.Index] {
+			seen[bi.item.Index] = true
+			indices = append(indices, bi.item.Index)
+		}
+	}
+	return indices
+}
+
+// ensureIndices creates any missing target index of items.
+func (b *batcher) ensureIndices(items []batchItem) error {
+	if b.indices == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, bi := range items {
+		if seen[bi.item.Index] {
+			continue
+		}
+		seen[bi.item.Index] = true
+		if err := b.indices.ensure(b.ctx, bi.item.Index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush sends any buffered documents and waits for in-flight requests.
+func (b *batcher) flush(reason FlushReason) {
+	b.mu.Lock()
+	b.flushLocked(reason)
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+// undrained returns the number of documents buffered or being sent.
+func (b *batcher) undrained() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.items) + int(b.inflight.Load())
+}
+
+// depth returns the number of documents buffered or being sent without locking.
+// It may be momentarily off by one batch while a flush is in progress.
+func (b *batcher) depth() int {
+	return int(b.buffered.Load() + b.inflight.Load())
+}
+
+// close stops the interval flusher and flushes remaining documents.
+func (b *batcher) close() {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+	})
+	b.flush(FlushReasonManual)
+}
+
+// run flushes the batch every flushInterval until the batcher is closed.
+func (b *batcher) run() {
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.mu.Lock()
+			b.flushLocked(FlushReasonInterval)
+			b.mu.Unlock()
+		case <-b.stopCh:
+			return
+		}
+	}
+}
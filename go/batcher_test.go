@@ -0,0 +1,741 @@
+package devlogs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bulkRecorder is a mock _bulk endpoint that records each request body.
+type bulkRecorder struct {
+	mu       sync.Mutex
+	requests [][]byte
+}
+
+func (br *bulkRecorder) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("expected path /_bulk, got %s", r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("expected Content-Type=application/x-ndjson, got %s", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		br.mu.Lock()
+		br.requests = append(br.requests, body)
+		br.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}
+}
+
+// docCounts returns the number of documents in each recorded bulk request.
+func (br *bulkRecorder) docCounts() []int {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	counts := make([]int, len(br.requests))
+	for i, body := range br.requests {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		lines := 0
+		for scanner.Scan() {
+			lines++
+		}
+		counts[i] = lines / 2
+	}
+	return counts
+}
+
+func newBatchingTestHandler(t *testing.T, br *bulkRecorder, opts ...HandlerOption) *Handler {
+	server := httptest.NewServer(br.handler(t))
+	t.Cleanup(server.Close)
+
+	cfg := testServerConfig(server.URL)
+	opts = append([]HandlerOption{WithCircuitBreaker(NewCircuitBreaker(60*time.Second, 10*time.Second))}, opts...)
+	h, err := NewHandler(cfg, opts...)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	return h
+}
+
+func TestBatchingFlushesOnCount(t *testing.T) {
+	br := &bulkRecorder{}
+	h := newBatchingTestHandler(t, br, WithBatching(5, 0))
+	logger := slog.New(h)
+
+	for i := 0; i < 12; i++ {
+		logger.Info("message", "i", i)
+	}
+	h.Flush()
+
+	// Batches are sent concurrently, so compare sizes without order
+	counts := br.docCounts()
+	sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+	if len(counts) != 3 || counts[0] != 5 || counts[1] != 5 || counts[2] != 2 {
+		t.Errorf("expected bulk batches of sizes [5 5 2], got %v", counts)
+	}
+}
+
+func TestBatchingFlushesOnInterval(t *testing.T) {
+	br := &bulkRecorder{}
+	h := newBatchingTestHandler(t, br, WithBatching(100, 20*time.Millisecond))
+	defer h.Close()
+
+	slog.New(h).Info("message")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(br.docCounts()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if counts := br.docCounts(); len(counts) != 1 || counts[0] != 1 {
+		t.Errorf("expected one interval flush with 1 doc, got %v", counts)
+	}
+}
+
+func TestMaxBatchAgeFlushesLowTraffic(t *testing.T) {
+	br := &bulkRecorder{}
+	const maxAge = 50 * time.Millisecond
+	h := newBatchingTestHandler(t, br, WithBatching(100, 0), WithMaxBatchAge(maxAge))
+	defer h.Close()
+
+	start := time.Now()
+	slog.New(h).Info("message")
+
+	for len(br.docCounts()) == 0 && time.Since(start) < 2*time.Second {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if counts := br.docCounts(); len(counts) != 1 || counts[0] != 1 {
+		t.Fatalf("expected one age-based flush with 1 doc, got %v", counts)
+	}
+	if elapsed := time.Since(start); elapsed > maxAge+500*time.Millisecond {
+		t.Errorf("expected flush within %v, took %v", maxAge, elapsed)
+	}
+}
+
+func TestFlushTriggersReportReason(t *testing.T) {
+	// waitForBatch waits for the first bulk request, failing after a deadline
+	waitForBatch := func(t *testing.T, br *bulkRecorder) {
+		deadline := time.Now().Add(2 * time.Second)
+		for len(br.docCounts()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if len(br.docCounts()) == 0 {
+			t.Fatal("expected a batch to be sent")
+		}
+	}
+
+	t.Run("count", func(t *testing.T) {
+		br := &bulkRecorder{}
+		h := newBatchingTestHandler(t, br, WithFlushOnCount(3))
+		defer h.Close()
+		logger := slog.New(h)
+		for i := 0; i < 3; i++ {
+			logger.Info("message", "i", i)
+		}
+		waitForBatch(t, br)
+		if got := h.LastFlushReason(); got != FlushReasonCount {
+			t.Errorf("expected count, got %v", got)
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		br := &bulkRecorder{}
+		h := newBatchingTestHandler(t, br, WithFlushOnBytes(2048))
+		defer h.Close()
+		logger := slog.New(h)
+		// With no count or interval trigger, only the byte budget can flush
+		for i := 0; i < 3; i++ {
+			logger.Info("message", "payload", strings.Repeat("x", 1024))
+		}
+		waitForBatch(t, br)
+		if got := h.LastFlushReason(); got != FlushReasonBytes {
+			t.Errorf("expected bytes, got %v", got)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		br := &bulkRecorder{}
+		h := newBatchingTestHandler(t, br, WithFlushOnInterval(20*time.Millisecond))
+		defer h.Close()
+		slog.New(h).Info("message")
+		waitForBatch(t, br)
+		if got := h.LastFlushReason(); got != FlushReasonInterval {
+			t.Errorf("expected interval, got %v", got)
+		}
+	})
+
+	t.Run("manual", func(t *testing.T) {
+		br := &bulkRecorder{}
+		h := newBatchingTestHandler(t, br, WithFlushOnCount(100))
+		if got := h.LastFlushReason(); got != FlushReasonNone {
+			t.Errorf("expected none before any flush, got %v", got)
+		}
+		slog.New(h).Info("message")
+		h.Flush()
+		if got := h.LastFlushReason(); got != FlushReasonManual || got.String() != "manual" {
+			t.Errorf("expected manual, got %v", got)
+		}
+	})
+
+	if _, err := NewHandler(DefaultConfig(), WithFlushOnInterval(0)); err == nil {
+		t.Error("expected an error for a zero flush interval")
+	}
+
+	// A later WithBatching without a count must not turn batching back off
+	h, _ := NewHandler(DefaultConfig(), WithFlushOnBytes(2048), WithBatching(0, time.Second))
+	defer h.Close()
+	if h.batcher == nil {
+		t.Error("expected WithBatching(0, d) to keep batching enabled by WithFlushOnBytes")
+	}
+
+	// Nor may it discard triggers set by earlier flush options
+	h, _ = NewHandler(DefaultConfig(), WithFlushOnCount(3), WithFlushOnInterval(time.Minute), WithBatching(100, time.Second))
+	defer h.Close()
+	if h.batchSize != 3 || h.batchInterval != time.Minute {
+		t.Errorf("expected earlier flush triggers kept, got count %d and interval %v", h.batchSize, h.batchInterval)
+	}
+	h, _ = NewHandler(DefaultConfig(), WithFlushOnInterval(time.Minute), WithBatching(100, 0))
+	defer h.Close()
+	if h.batchSize != 100 || h.batchInterval != time.Minute {
+		t.Errorf("expected WithBatching to fill only the unset trigger, got count %d and interval %v", h.batchSize, h.batchInterval)
+	}
+}
+
+func TestBatchingWithAsyncWorkersStartsNoWorkers(t *testing.T) {
+	br := &bulkRecorder{}
+	h := newBatchingTestHandler(t, br, WithAsyncWorkers(8), WithBatching(5, 0))
+	if h.workers != nil {
+		t.Fatal("expected no worker pool alongside batching")
+	}
+	logger := slog.New(h)
+	for i := 0; i < 10; i++ {
+		logger.Info("message", "i", i)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if counts := br.docCounts(); !reflect.DeepEqual(counts, []int{5, 5}) {
+		t.Errorf("expected records sent in two batches of 5, got %v", counts)
+	}
+	if _, capacity := h.QueueDepth(); capacity != 5 {
+		t.Errorf("expected the batch size as queue capacity, got %d", capacity)
+	}
+}
+
+func TestBulkByteLimitFlushesBeforeCount(t *testing.T) {
+	br := &bulkRecorder{}
+	const limit = 8 * 1024
+	h := newBatchingTestHandler(t, br, WithBatching(100, 0), WithBulkByteLimit(limit))
+	logger := slog.New(h)
+
+	large := strings.Repeat("x", 2000)
+	for i := 0; i < 20; i++ {
+		logger.Info(large)
+	}
+	h.Flush()
+
+	counts := br.docCounts()
+	if len(counts) < 2 {
+		t.Fatalf("expected size-based flushes before the count threshold, got %v", counts)
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total != 20 {
+		t.Errorf("expected 20 documents delivered, got %d", total)
+	}
+
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	for i, body := range br.requests {
+		if len(body) > limit {
+			t.Errorf("bulk request %d is %d bytes, exceeds limit %d", i, len(body), limit)
+		}
+	}
+}
+
+func TestClientBulk(t *testing.T) {
+	br := &bulkRecorder{}
+	server := httptest.NewServer(br.handler(t))
+	defer server.Close()
+
+	client := NewClient(testServerConfig(server.URL))
+	err := client.Bulk(context.Background(), []BulkItem{
+		{Document: map[string]string{"message": "a"}},
+		{Index: "other-index", Document: map[string]string{"message": "b"}},
+	})
+	if err != nil {
+		t.Fatalf("Bulk failed: %v", err)
+	}
+
+	body := string(br.requests[0])
+	if !strings.Contains(body, `{"index":{"_index":"devlogs-0001"}}`) {
+		t.Errorf("expected default index action, got %s", body)
+	}
+	if !strings.Contains(body, `{"index":{"_index":"other-index"}}`) {
+		t.Errorf("expected explicit index action, got %s", body)
+	}
+}
+
+func TestFlushOnLevelFlushesBufferedRecords(t *testing.T) {
+	br := &bulkRecorder{}
+	h := newBatchingTestHandler(t, br, WithBatching(100, 0), WithFlushOnLevel(slog.LevelError))
+	defer h.Close()
+	logger := slog.New(h)
+
+	logger.Info("first")
+	logger.Info("second")
+	if counts := br.docCounts(); len(counts) != 0 {
+		t.Fatalf("expected info records to stay buffered, got %v", counts)
+	}
+
+	logger.Error("failure")
+
+	counts := br.docCounts()
+	if len(counts) != 1 || counts[0] != 3 {
+		t.Errorf("expected one synchronous flush of 3 docs, got %v", counts)
+	}
+}
+
+func TestIngestTimestampSetWhenBulkIsSent(t *testing.T) {
+	br := &bulkRecorder{}
+	h := newBatchingTestHandler(t, br, WithBatching(100, 0), WithIngestTimestamp())
+	defer h.Close()
+
+	slog.New(h).Info("buffered")
+	time.Sleep(20 * time.Millisecond)
+	h.Flush()
+
+	br.mu.Lock()
+	lines := strings.Split(strings.TrimSpace(string(br.requests[0])), "\n")
+	br.mu.Unlock()
+
+	var doc map[string]interface{}
+	json.Unmarshal([]byte(lines[1]), &doc)
+
+	const layout = "2006-01-02T15:04:05.000Z"
+	eventTime, _ := time.Parse(layout, doc["timestamp"].(string))
+	ingestStr, ok := doc["ingest_timestamp"].(string)
+	if !ok {
+		t.Fatalf("expected ingest_timestamp, got %v", doc)
+	}
+	ingestTime, _ := time.Parse(layout, ingestStr)
+
+	if ingestTime.Before(eventTime) {
+		t.Errorf("expected ingest time %s >= event time %s", ingestStr, doc["timestamp"])
+	}
+	if ingestTime.Sub(eventTime) < 20*time.Millisecond {
+		t.Errorf("expected ingest time to reflect batching delay, got %v", ingestTime.Sub(eventTime))
+	}
+}
+
+func TestUpsertKeyProducesStableIDs(t *testing.T) {
+	br := &bulkRecorder{}
+	byOrder := func(doc *LogDocument) string {
+		return "order-" + doc.Fields["order_id"].(string)
+	}
+	h := newBatchingTestHandler(t, br, WithBatching(100, 0), WithUpsertKey(byOrder))
+	logger := slog.New(h)
+
+	logger.Info("order shipped", "order_id", "1001")
+	logger.Info("order shipped", "order_id", "1001")
+	h.Flush()
+
+	br.mu.Lock()
+	lines := strings.Split(strings.TrimSpace(string(br.requests[0])), "\n")
+	br.mu.Unlock()
+
+	var ids []string
+	for i := 0; i < len(lines); i += 2 {
+		var action map[string]map[string]string
+		json.Unmarshal([]byte(lines[i]), &action)
+		ids = append(ids, action["index"]["_id"])
+	}
+	if len(ids) != 2 || ids[0] != "order-1001" || ids[1] != ids[0] {
+		t.Errorf("expected identical _id actions, got %v", ids)
+	}
+}
+
+func TestRetryIDsKeepIdenticalRecords(t *testing.T) {
+	br := &bulkRecorder{}
+	h := newBatchingTestHandler(t, br, WithBatching(100, 0), WithRetry(3, time.Millisecond))
+
+	// Identical records in the same millisecond must not share an _id
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, "retrying", 0)
+	h.Handle(context.Background(), r)
+	h.Handle(context.Background(), r)
+	h.Flush()
+
+	br.mu.Lock()
+	lines := strings.Split(strings.TrimSpace(string(br.requests[0])), "\n")
+	br.mu.Unlock()
+
+	ids := make(map[string]bool)
+	for i := 0; i < len(lines); i += 2 {
+		var action map[string]map[string]string
+		json.Unmarshal([]byte(lines[i]), &action)
+		ids[action["index"]["_id"]] = true
+	}
+	if len(lines) != 4 || len(ids) != 2 || ids[""] {
+		t.Errorf("expected both records indexed under distinct _ids, got %v", lines)
+	}
+}
+
+func TestCloseShutdownTimeout(t *testing.T) {
+	server := slowServer()
+	defer server.Close()
+
+	h, err := NewHandler(testServerConfig(server.URL), WithBatching(2, 0), WithShutdownTimeout(100*time.Millisecond),
+		WithCircuitBreaker(NewCircuitBreaker(60*time.Second, 10*time.Second)))
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(h)
+
+	// Two records go out as a hung bulk request; the third stays buffered
+	for i := 0; i < 3; i++ {
+		logger.Info("message", "i", i)
+	}
+
+	start := time.Now()
+	err = h.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Close to return within the timeout, took %v", elapsed)
+	}
+
+	var timeoutErr *ShutdownTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected ShutdownTimeoutError, got %v", err)
+	}
+	if timeoutErr.Undrained != 3 {
+		t.Errorf("expected 3 undrained records, got %d", timeoutErr.Undrained)
+	}
+	if h.Dropped() != 3 {
+		t.Errorf("expected 3 dropped records, got %d", h.Dropped())
+	}
+}
+
+func TestBatchCompressionThreshold(t *testing.T) {
+	var mu sync.Mutex
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		mu.Unlock()
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	h, err := NewHandler(testServerConfig(server.URL),
+		WithBatching(100, 0),
+		WithClientOptions(WithCompression(), WithCompressionThreshold(4096)))
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(h)
+
+	logger.Info("small")
+	h.Flush()
+	for i := 0; i < 10; i++ {
+		logger.Info(strings.Repeat("x", 1000))
+	}
+	h.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(encodings) != 2 || encodings[0] != "" || encodings[1] != "gzip" {
+		t.Errorf("expected small batch plain and large batch gzipped, got %q", encodings)
+	}
+}
+
+func TestMaxConcurrentBulk(t *testing.T) {
+	var active, peak atomic.Int64
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		io.Copy(io.Discard, r.Body)
+		time.Sleep(10 * time.Millisecond)
+		requests.Add(1)
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	h, err := NewHandler(testServerConfig(server.URL), WithBatching(1, 0), WithMaxConcurrentBulk(2))
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(h)
+
+	for i := 0; i < 20; i++ {
+		logger.Info("rapid flush", "i", i)
+	}
+	h.Flush()
+
+	if peak.Load() > 2 {
+		t.Errorf("expected at most 2 concurrent bulk requests, saw %d", peak.Load())
+	}
+	if requests.Load() != 20 {
+		t.Errorf("expected all 20 flushes to be sent, got %d", requests.Load())
+	}
+}
+
+func TestBulkOrderingSurvivesRetry(t *testing.T) {
+	var mu sync.Mutex
+	var indexed []string
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+		if first {
+			// Fail the first batch so it is retried while later batches are flushed
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		mu.Lock()
+		for i := 1; i < len(lines); i += 2 {
+			var doc LogDocument
+			json.Unmarshal([]byte(lines[i]), &doc)
+			indexed = append(indexed, doc.Message)
+		}
+		mu.Unlock()
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	h, err := NewHandler(testServerConfig(server.URL), WithBatching(1, 0),
+		WithRetry(3, 20*time.Millisecond), WithBulkOrdering())
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(h)
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		msg := fmt.Sprintf("step %d", i)
+		want = append(want, msg)
+		logger.Info(msg)
+	}
+	h.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(indexed, want) {
+		t.Errorf("expected records indexed in emit order, got %v", indexed)
+	}
+}
+
+func TestBatchErrorHandlerReceivesRejectedItems(t *testing.T) {
+	var bodies []string
+	var bodiesMu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodiesMu.Lock()
+		bodies = append(bodies, string(body))
+		first := len(bodies) == 1
+		bodiesMu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		if !first {
+			w.Write([]byte(`{"errors":false,"items":[]}`))
+			return
+		}
+		w.Write([]byte(`{"errors":true,"items":[` +
+			`{"index":{"_index":"devlogs-0001","status":201}},` +
+			`{"index":{"_index":"devlogs-0001","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [fields.count]"}}}]}`))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var failed []FailedItem
+	var diagnostics strings.Builder
+	h, err := NewHandler(testServerConfig(server.URL),
+		WithBatching(2, 0),
+		WithSelfLogging(slog.New(slog.NewTextHandler(&diagnostics, nil))),
+		WithBatchErrorHandler(func(items []FailedItem) {
+			mu.Lock()
+			failed = append(failed, items...)
+			mu.Unlock()
+		}))
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(h)
+
+	logger.Info("accepted")
+	logger.Info("rejected", "count", "many")
+	h.Flush()
+	logger.Info("later one")
+	logger.Info("later two")
+	h.Flush()
+
+	if h.cb.IsOpen() {
+		t.Error("expected rejected items to leave the breaker closed")
+	}
+	if diagnostics.Len() != 0 {
+		t.Errorf("expected rejected items left to the handler, got self-log %q", diagnostics.String())
+	}
+	bodiesMu.Lock()
+	if len(bodies) != 2 || !strings.Contains(bodies[1], "later one") || !strings.Contains(bodies[1], "later two") {
+		t.Errorf("expected later records still indexed, got %q", bodies)
+	}
+	bodiesMu.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 1 {
+		t.Fatalf("expected 1 failed item, got %d", len(failed))
+	}
+	doc, ok := failed[0].Item.Document.(*LogDocument)
+	if !ok || doc.Message != "rejected" {
+		t.Errorf("expected the rejected document, got %#v", failed[0].Item.Document)
+	}
+	if failed[0].Status != 400 || !strings.Contains(failed[0].Reason, "mapper_parsing_exception") {
+		t.Errorf("unexpected status/reason: %d %q", failed[0].Status, failed[0].Reason)
+	}
+}
+
+func TestPartialBulkFailureLeavesBreakerClosed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"errors":true,"items":[` +
+			`{"index":{"_index":"devlogs-0001","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [fields.count]"}}}]}`))
+	}))
+	defer server.Close()
+
+	for _, perIndex := range []bool{false, true} {
+		opts := []HandlerOption{WithBatching(1, 0)}
+		if perIndex {
+			opts = append(opts, WithPerIndexCircuitBreaker())
+		}
+		h, err := NewHandler(testServerConfig(server.URL), opts...)
+		if err != nil {
+			t.Fatalf("NewHandler failed: %v", err)
+		}
+		slog.New(h).Info("rejected", "count", "many")
+		h.Flush()
+
+		if h.cb.IsOpen() {
+			t.Errorf("perIndex=%v: expected the breaker to stay closed", perIndex)
+		}
+		if open := h.OpenIndices(); len(open) != 0 {
+			t.Errorf("perIndex=%v: expected no paused indices, got %v", perIndex, open)
+		}
+		h.Close()
+	}
+}
+
+func TestHandlerQueueDepth(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	h, err := NewHandler(testServerConfig(server.URL), WithBatching(2, 0))
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(h)
+
+	if length, capacity := h.QueueDepth(); length != 0 || capacity != 2 {
+		t.Fatalf("expected empty queue of capacity 2, got %d/%d", length, capacity)
+	}
+
+	for i := 0; i < 5; i++ {
+		logger.Info("message", "i", i)
+		if length, _ := h.QueueDepth(); length != i+1 {
+			t.Errorf("expected depth %d after %d records, got %d", i+1, i+1, length)
+		}
+	}
+
+	close(release)
+	h.Flush()
+	if length, _ := h.QueueDepth(); length != 0 {
+		t.Errorf("expected depth 0 after drain, got %d", length)
+	}
+}
+
+func TestLeakCheckWarnsWithoutClose(t *testing.T) {
+	leaked := make(chan struct{}, 1)
+	defer func(orig func(time.Time)) { reportLeak = orig }(reportLeak)
+	reportLeak = func(time.Time) {
+		select {
+		case leaked <- struct{}{}:
+		default:
+		}
+	}
+
+	func() {
+		h, err := NewHandler(DefaultConfig(), WithBatching(10, time.Hour), WithLeakCheck())
+		if err != nil {
+			t.Fatalf("NewHandler failed: %v", err)
+		}
+		slog.New(h).WithGroup("req").Info("never sent")
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case <-leaked:
+			return
+		case <-deadline:
+			t.Fatal("expected a leak warning for a handler dropped without Close")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestLeakCheckQuietAfterClose(t *testing.T) {
+	leaked := make(chan struct{}, 1)
+	defer func(orig func(time.Time)) { reportLeak = orig }(reportLeak)
+	reportLeak = func(time.Time) { leaked <- struct{}{} }
+
+	func() {
+		h, err := NewHandler(DefaultConfig(), WithBatching(10, time.Hour), WithLeakCheck())
+		if err != nil {
+			t.Fatalf("NewHandler failed: %v", err)
+		}
+		h.Close()
+	}()
+
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-leaked:
+		t.Error("expected no leak warning after Close")
+	default:
+	}
+}
@@ -1,84 +1,221 @@
-package devlogs
-
-import (
-	"fmt"
-	"os"
-	"sync"
-	"time"
-)
-
-// CircuitBreaker prevents cascade failures when OpenSearch is unavailable.
-type CircuitBreaker struct {
-	mu               sync.Mutex
-	isOpen           bool
-	openUntil        time.Time
-	lastErrorPrinted time.Time
-	duration         time.Duration
-	errorInterval    time.Duration
-}
-
-var (
-	defaultBreaker     *CircuitBreaker
-	defaultBreakerOnce sync.Once
-)
-
-// DefaultCircuitBreaker returns the shared circuit breaker instance.
-func DefaultCircuitBreaker() *CircuitBreaker {
-	defaultBreakerOnce.Do(func() {
-		defaultBreaker = NewCircuitBreaker(60*time.Second, 10*time.Second)
-	})
-	return defaultBreaker
-}
-
-// NewCircuitBreaker creates a new circuit breaker with custom durations.
-func NewCircuitBreaker(duration, errorInterval time.Duration) *CircuitBreaker {
-	return &CircuitBreaker{
-		duration:      duration,
-		errorInterval: errorInterval,
-	}
-}
-
-// IsOpen checks if the circuit breaker is currently open.
-func (cb *CircuitBreaker) IsOpen() bool {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	if !cb.isOpen {
-		return false
-	}
-
-	// Check if duration has expired
-	if time.Now().After(cb.openUntil) {
-		return false
-	}
-
-	return true
-}
-
-// RecordFailure opens the circuit breaker after a failure.
-func (cb *CircuitBreaker) RecordFailure(err error) {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	now := time.Now()
-	cb.isOpen = true
-	cb.openUntil = now.Add(cb.duration)
-
-	// Throttle error printing
-	if now.Sub(cb.lastErrorPrinted) > cb.errorInterval {
-		fmt.Fprintf(os.Stderr, "[devlogs] Failed to index log, pausing indexing for %.0fs: %v\n",
-			cb.duration.Seconds(), err)
-		cb.lastErrorPrinted = now
-	}
-}
-
-// RecordSuccess closes the circuit breaker on successful operation.
-func (cb *CircuitBreaker) RecordSuccess() {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	if cb.isOpen {
-		cb.isOpen = false
-		fmt.Fprintf(os.Stderr, "[devlogs] Connection restored, resuming indexing\n")
-	}
-}
+package devlogs
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CircuitBreaker prevents cascade failures when OpenSearch is unavailable.
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	isOpen           bool
+	openUntil        time.Time
+	lastErrorPrinted time.Time
+	duration         time.Duration
+	dnsDuration      time.Duration
+	errorInterval    time.Duration
+	logger           *slog.Logger
+}
+
+// DefaultDNSBackoff is how long the breaker stays open after a DNS resolution
+// failure. DNS errors during rollouts usually clear quickly, so this is much
+// shorter than the general circuit breaker duration.
+const DefaultDNSBackoff = 5 * time.Second
+
+var (
+	defaultBreaker     *CircuitBreaker
+	defaultBreakerOnce sync.Once
+)
+
+// DefaultCircuitBreaker returns the process-wide circuit breaker instance.
+// Handlers no longer use it by default; pass it to WithCircuitBreaker to share it.
+func DefaultCircuitBreaker() *CircuitBreaker {
+	defaultBreakerOnce.Do(func() {
+		defaultBreaker = NewCircuitBreaker(60*time.Second, 10*time.Second)
+	})
+	return defaultBreaker
+}
+
+// NewCircuitBreaker creates a new circuit breaker with custom durations.
+func NewCircuitBreaker(duration, errorInterval time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		duration:      duration,
+		dnsDuration:   DefaultDNSBackoff,
+		errorInterval: errorInterval,
+	}
+}
+
+// NewCircuitBreakerFromConfig creates a circuit breaker using the durations in cfg.
+func NewCircuitBreakerFromConfig(cfg *Config) *CircuitBreaker {
+	cb := NewCircuitBreaker(cfg.CircuitBreakerDuration, cfg.ErrorPrintInterval)
+	cb.SetDNSBackoff(cfg.DNSBackoffDuration)
+	return cb
+}
+
+// SetDNSBackoff sets how long the breaker stays open after a DNS failure.
+// A zero value uses the regular breaker duration for DNS failures too.
+func (cb *CircuitBreaker) SetDNSBackoff(d time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.dnsDuration = d
+}
+
+// SetLogger routes the breaker's diagnostics to logger instead of stderr.
+// A nil logger restores the stderr default.
+func (cb *CircuitBreaker) SetLogger(logger *slog.Logger) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.logger = logger
+}
+
+// IsOpen checks if the circuit breaker is currently open.
+func (cb *CircuitBreaker) IsOpen() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !cb.isOpen {
+		return false
+	}
+
+	// Check if duration has expired
+	if time.Now().After(cb.openUntil) {
+		return false
+	}
+
+	return true
+}
+
+// RecordFailure opens the circuit breaker after a failure.
+func (cb *CircuitBreaker) RecordFailure(err error) {
+	cb.mu.Lock()
+	now := time.Now()
+	duration := cb.backoffFor(err)
+	cb.isOpen = true
+	cb.openUntil = now.Add(duration)
+
+	// Throttle error printing
+	report := now.Sub(cb.lastErrorPrinted) > cb.errorInterval
+	if report {
+		cb.lastErrorPrinted = now
+	}
+	logger := cb.logger
+	cb.mu.Unlock()
+
+	// Report outside the lock; the logger may call back into IsOpen
+	if report {
+		selfLog(logger, slog.LevelError,
+			fmt.Sprintf("Failed to index log, pausing indexing for %.0fs: %v", duration.Seconds(), err),
+			slog.Duration("pause", duration), slog.Any("error", err))
+	}
+}
+
+// RecordSuccess closes the circuit breaker on successful operation.
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.recordSuccess()
+}
+
+// recordSuccess closes the breaker and reports whether it was open.
+func (cb *CircuitBreaker) recordSuccess() bool {
+	cb.mu.Lock()
+	restored := cb.isOpen
+	cb.isOpen = false
+	logger := cb.logger
+	cb.mu.Unlock()
+
+	if restored {
+		selfLog(logger, slog.LevelInfo, "Connection restored, resuming indexing")
+	}
+	return restored
+}
+
+// backoffFor returns how long the breaker should stay open for err.
+func (cb *CircuitBreaker) backoffFor(err error) time.Duration {
+	var dnsErr *net.DNSError
+	if cb.dnsDuration > 0 && cb.dnsDuration < cb.duration && errors.As(err, &dnsErr) {
+		return cb.dnsDuration
+	}
+	return cb.duration
+}
+
+// breakerIdleTimeout is how long a closed per-index breaker may go unused
+// before breakerSet evicts it.
+const breakerIdleTimeout = 10 * time.Minute
+
+// breakerSet holds a circuit breaker per index, created on first use, so a
+// failing index pauses only its own sends (see WithPerIndexCircuitBreaker).
+// Breakers that are closed and idle are evicted, so date- or tenant-based
+// index names do not accumulate; a fresh closed breaker behaves the same.
+type breakerSet struct {
+	mu         sync.Mutex
+	breakers   map[string]*breakerEntry
+	newBreaker func() *CircuitBreaker
+	idle       time.Duration
+	lastSweep  time.Time
+}
+
+// breakerEntry is a breaker and when it was last used.
+type breakerEntry struct {
+	cb       *CircuitBreaker
+	lastUsed time.Time
+}
+
+func newBreakerSet(newBreaker func() *CircuitBreaker) *breakerSet {
+	return &breakerSet{
+		breakers:   make(map[string]*breakerEntry),
+		newBreaker: newBreaker,
+		idle:       breakerIdleTimeout,
+		lastSweep:  time.Now(),
+	}
+}
+
+// get returns the breaker for index, creating it if needed.
+func (s *breakerSet) get(index string) *CircuitBreaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) > s.idle {
+		s.sweepLocked(now)
+	}
+	entry, ok := s.breakers[index]
+	if !ok {
+		entry = &breakerEntry{cb: s.newBreaker()}
+		s.breakers[index] = entry
+	}
+	entry.lastUsed = now
+	return entry.cb
+}
+
+// sweepLocked evicts breakers that are closed and unused for longer than
+// s.idle. Caller holds s.mu.
+func (s *breakerSet) sweepLocked(now time.Time) {
+	s.lastSweep = now
+	for index, entry := range s.breakers {
+		if now.Sub(entry.lastUsed) > s.idle && !entry.cb.IsOpen() {
+			delete(s.breakers, index)
+		}
+	}
+}
+
+// open returns the sorted names of indices whose breaker is open.
+func (s *breakerSet) open() []string {
+	s.mu.Lock()
+	breakers := make(map[string]*CircuitBreaker, len(s.breakers))
+	for index, entry := range s.breakers {
+		breakers[index] = entry.cb
+	}
+	s.mu.Unlock()
+
+	var open []string
+	for index, cb := range breakers {
+		if cb.IsOpen() {
+			open = append(open, index)
+		}
+	}
+	sort.Strings(open)
+	return open
+}
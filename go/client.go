@@ -1,82 +1,1019 @@
-package devlogs
-
-import (
-	"bytes"
-	"context"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-)
-
-// Client is the OpenSearch HTTP client.
-type Client struct {
-	baseURL    string
-	authHeader string
-	httpClient *http.Client
-	indexName  string
-}
-
-// NewClient creates a new OpenSearch client from config.
-func NewClient(cfg *Config) *Client {
-	authStr := base64.StdEncoding.EncodeToString(
-		[]byte(cfg.User + ":" + cfg.Password),
-	)
-
-	return &Client{
-		baseURL:    cfg.BaseURL(),
-		authHeader: "Basic " + authStr,
-		httpClient: &http.Client{
-			Timeout: cfg.Timeout,
-		},
-		indexName: cfg.Index,
-	}
-}
-
-// Index sends a document to OpenSearch.
-func (c *Client) Index(ctx context.Context, doc interface{}) error {
-	jsonData, err := json.Marshal(doc)
-	if err != nil {
-		return fmt.Errorf("failed to marshal document: %w", err)
-	}
-
-	url := fmt.Sprintf("%s/%s/_doc", c.baseURL, c.indexName)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
-	if err != nil {
-		return NewConnectionError("failed to create request", err)
-	}
-
-	req.Header.Set("Authorization", c.authHeader)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return NewConnectionError(fmt.Sprintf("cannot connect to OpenSearch at %s", c.baseURL), err)
-	}
-	defer resp.Body.Close()
-
-	// Read body for error messages
-	body, _ := io.ReadAll(resp.Body)
-
-	switch resp.StatusCode {
-	case http.StatusOK, http.StatusCreated:
-		return nil
-	case http.StatusUnauthorized:
-		return NewAuthError("authentication failed (HTTP 401)")
-	case http.StatusNotFound:
-		return NewIndexNotFoundError(c.indexName)
-	case http.StatusBadRequest:
-		return NewQueryError(fmt.Sprintf("bad request: %s", string(body)))
-	default:
-		return NewConnectionError(
-			fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, string(body)),
-			nil,
-		)
-	}
-}
-
-// IndexName returns the configured index name.
-func (c *Client) IndexName() string {
-	return c.indexName
-}
+package devlogs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is the OpenSearch HTTP client.
+type Client struct {
+	// connMu guards baseURL, authHeader and httpClient, which Reconfigure may replace
+	connMu     sync.RWMutex
+	baseURL    string
+	authHeader string
+	httpClient *http.Client
+
+	// indexMu guards indexName, which SetIndex may change at runtime, and the
+	// fields Reconfigure updates with it. configIndex is the Config.Index that
+	// indexName was last set from.
+	indexMu     sync.RWMutex
+	indexName   string
+	configIndex string
+
+	// useDataStream writes to indexName as a data stream (see Bootstrap)
+	useDataStream bool
+
+	encoder     func(*LogDocument) ([]byte, error)
+	contentType string
+
+	// envelope wraps a LogDocument before JSON encoding (nil sends it bare)
+	envelope func(*LogDocument) interface{}
+
+	// headers are added to every request
+	headers   map[string]string
+	userAgent string
+
+	// validateResponse checks the result of single-document index responses
+	validateResponse bool
+
+	// logger receives the client's own diagnostics (nil means stderr)
+	logger *slog.Logger
+
+	// softFailMarshal replaces documents that fail to encode with a minimal one
+	softFailMarshal bool
+
+	// chaos and chaosDelay inject failures and latency for tests (see WithChaos)
+	chaos      func() error
+	chaosDelay time.Duration
+
+	// contextTimeout bounds requests whose context has no deadline (0 disables)
+	contextTimeout time.Duration
+
+	// gzip request bodies when compress is set
+	compress             bool
+	compressionLevel     int
+	compressionThreshold int
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client) error
+
+// WithEncoder overrides how a LogDocument is serialized before it is sent.
+// The default is json.Marshal. Encoded documents sent through the bulk API
+// must not contain newlines.
+func WithEncoder(encoder func(*LogDocument) ([]byte, error)) ClientOption {
+	return func(c *Client) error {
+		c.encoder = encoder
+		return nil
+	}
+}
+
+// WithEnvelope wraps every LogDocument in the value envelope returns before it
+// is JSON-encoded, for pipelines that expect e.g. {"@metadata": {...},
+// "event": {...}} instead of the bare document. It has no effect on documents
+// serialized by WithEncoder. A nil envelope sends the bare document.
+func WithEnvelope(envelope func(*LogDocument) interface{}) ClientOption {
+	return func(c *Client) error {
+		c.envelope = envelope
+		return nil
+	}
+}
+
+// WithContentType sets the Content-Type header for single-document requests.
+// Use it alongside WithEncoder when the encoder does not produce JSON.
+func WithContentType(contentType string) ClientOption {
+	return func(c *Client) error {
+		c.contentType = contentType
+		return nil
+	}
+}
+
+// reservedHeaders are set by the client itself and cannot come from WithHeaders.
+var reservedHeaders = map[string]bool{
+	"Authorization":    true,
+	"Content-Type":     true,
+	"Content-Encoding": true,
+}
+
+// WithHeaders adds static headers to every request, e.g. for a gateway that
+// requires a tenant header. Authorization, Content-Type and Content-Encoding,
+// which the client sets itself, are ignored.
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(c *Client) error {
+		if c.headers == nil {
+			c.headers = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			if !reservedHeaders[http.CanonicalHeaderKey(k)] {
+				c.headers[k] = v
+			}
+		}
+		return nil
+	}
+}
+
+// WithResponseValidation makes Index, IndexTo and IndexWithID check the
+// "result" of the index response and return an *UnexpectedResultError unless
+// the document was "created" or "updated" (e.g. "noop"), instead of trusting
+// a 2xx status alone.
+func WithResponseValidation() ClientOption {
+	return func(c *Client) error {
+		c.validateResponse = true
+		return nil
+	}
+}
+
+// WithClientSelfLogging routes the client's own diagnostics, such as what
+// Bootstrap created, to logger instead of stderr. NewHandler applies the
+// handler's WithSelfLogging logger to the client it creates.
+func WithClientSelfLogging(logger *slog.Logger) ClientOption {
+	return func(c *Client) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithSoftFailOnMarshalError indexes a minimal document instead of failing
+// when a LogDocument cannot be encoded, e.g. because a field holds a channel or
+// function. The minimal document keeps application, component, timestamp,
+// level and a truncated message, and notes the encoding error in
+// _marshal_error, so the event is still recorded.
+func WithSoftFailOnMarshalError() ClientOption {
+	return func(c *Client) error {
+		c.softFailMarshal = true
+		return nil
+	}
+}
+
+// WithContextTimeout bounds every request whose context has no deadline, so a
+// call made with context.Background cannot hang even when the HTTP client
+// timeout is zero. Contexts that already carry a deadline keep it.
+func WithContextTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		if d < 0 {
+			return fmt.Errorf("invalid context timeout %v", d)
+		}
+		c.contextTimeout = d
+		return nil
+	}
+}
+
+// WithChaos is a test hook for verifying behavior under OpenSearch
+// degradation. hook is called before every request; if it returns an error,
+// the request is not made and the error is returned in its place, so returning
+// a *ConnectionError simulates an outage. It is meant for tests and staging
+// only and must not be set in production.
+func WithChaos(hook func() error) ClientOption {
+	return func(c *Client) error {
+		c.chaos = hook
+		return nil
+	}
+}
+
+// WithChaosDelay is a test hook that delays every request WithChaos lets
+// through by d, simulating a slow cluster. The delay honors the request's
+// context, so it trips timeouts the way a slow response would. It is meant for
+// tests and staging only and must not be set in production.
+func WithChaosDelay(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		if d < 0 {
+			return fmt.Errorf("invalid chaos delay %v", d)
+		}
+		c.chaosDelay = d
+		return nil
+	}
+}
+
+// WithUserAgent replaces the default User-Agent header, devlogs-go/<Version>.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) error {
+		c.userAgent = userAgent
+		return nil
+	}
+}
+
+// NewClient creates a new OpenSearch client from config.
+func NewClient(cfg *Config) *Client {
+	return &Client{
+		baseURL:    cfg.BaseURL(),
+		authHeader: basicAuth(cfg.User, cfg.Password),
+		httpClient: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		indexName:     cfg.Index,
+		configIndex:   cfg.Index,
+		useDataStream: cfg.UseDataStream,
+		contentType:   "application/json",
+		userAgent:     "devlogs-go/" + Version,
+	}
+}
+
+// WithCompression gzips request bodies using the default compression level.
+func WithCompression() ClientOption {
+	return WithCompressionLevel(gzip.DefaultCompression)
+}
+
+// WithCompressionLevel gzips request bodies at the given level, trading CPU for
+// ratio. Valid levels are gzip.DefaultCompression and gzip.BestSpeed through
+// gzip.BestCompression; gzip.BestSpeed is usually the right choice for log shipping.
+func WithCompressionLevel(level int) ClientOption {
+	return func(c *Client) error {
+		if level != gzip.DefaultCompression && (level < gzip.BestSpeed || level > gzip.BestCompression) {
+			return fmt.Errorf("invalid compression level %d", level)
+		}
+		c.compress = true
+		c.compressionLevel = level
+		return nil
+	}
+}
+
+// WithCompressionThreshold only gzips request bodies larger than minBytes, so
+// small flushes from low-traffic services skip the CPU cost of compression.
+// Smaller bodies are sent as plain text without Content-Encoding. Only applies
+// with WithCompression or WithCompressionLevel.
+func WithCompressionThreshold(minBytes int) ClientOption {
+	return func(c *Client) error {
+		if minBytes < 0 {
+			return fmt.Errorf("invalid compression threshold %d", minBytes)
+		}
+		c.compressionThreshold = minBytes
+		return nil
+	}
+}
+
+// WithHTTP2 controls whether the client negotiates HTTP/2 with OpenSearch.
+// Some proxies benefit from HTTP/2 multiplexing while others misbehave with it.
+// Without this option Go's default behavior applies.
+func WithHTTP2(enabled bool) ClientOption {
+	return func(c *Client) error {
+		t := c.transport()
+		t.ForceAttemptHTTP2 = enabled
+		if enabled {
+			t.TLSNextProto = nil
+		} else {
+			// A non-nil empty map disables HTTP/2 upgrades
+			t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+		return nil
+	}
+}
+
+// transport returns the client's own *http.Transport, cloning the default
+// transport on first use so options never modify http.DefaultTransport.
+func (c *Client) transport() *http.Transport {
+	if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	c.httpClient.Transport = t
+	return t
+}
+
+// basicAuth returns the Authorization header value for user and password.
+// It is computed once per configuration so requests reuse the same string.
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// base returns the OpenSearch base URL.
+func (c *Client) base() string {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.baseURL
+}
+
+// Reconfigure points the client at the host, credentials, timeout, index and
+// data stream mode in cfg, e.g. after a credentials rotation. Requests already
+// in flight finish with the previous settings; later ones use the new
+// settings. An index set with SetIndex is kept unless cfg.Index differs from
+// the configured index it replaced. Options such as compression, headers and
+// the transport are kept.
+func (c *Client) Reconfigure(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	authHeader := basicAuth(cfg.User, cfg.Password)
+
+	c.connMu.Lock()
+	c.baseURL = cfg.BaseURL()
+	c.authHeader = authHeader
+	c.httpClient = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: c.httpClient.Transport,
+	}
+	c.connMu.Unlock()
+
+	c.indexMu.Lock()
+	if cfg.Index != c.configIndex {
+		c.indexName = cfg.Index
+		c.configIndex = cfg.Index
+	}
+	c.useDataStream = cfg.UseDataStream
+	c.indexMu.Unlock()
+	return nil
+}
+
+// NewClientWithOptions creates a new OpenSearch client and applies opts.
+func NewClientWithOptions(cfg *Config, opts ...ClientOption) (*Client, error) {
+	c := NewClient(cfg)
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// encode serializes a document, using the custom encoder or envelope for LogDocuments.
+func (c *Client) encode(doc interface{}) ([]byte, error) {
+	var data []byte
+	var err error
+	logDoc, isLogDoc := doc.(*LogDocument)
+	switch {
+	case isLogDoc && c.encoder != nil:
+		data, err = c.encoder(logDoc)
+	case isLogDoc && c.envelope != nil:
+		data, err = json.Marshal(c.envelope(logDoc))
+	default:
+		data, err = json.Marshal(doc)
+	}
+	if isLogDoc && err != nil && c.softFailMarshal {
+		data, err = json.Marshal(minimalDocument(logDoc, err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal document: %w", err)
+	}
+	return data, nil
+}
+
+// maxMinimalMessage bounds the message kept in a minimal document, in bytes.
+const maxMinimalMessage = 1024
+
+// minimalDocument returns the fields of doc that always encode, plus a
+// _marshal_error note describing why the full document could not be.
+func minimalDocument(doc *LogDocument, marshalErr error) map[string]interface{} {
+	message := doc.Message
+	if len(message) > maxMinimalMessage {
+		message = strings.ToValidUTF8(message[:maxMinimalMessage], "")
+	}
+	return map[string]interface{}{
+		"doc_type":       doc.DocType,
+		"schema_version": doc.SchemaVersion,
+		"application":    doc.Application,
+		"component":      doc.Component,
+		"timestamp":      doc.Timestamp,
+		"level":          doc.Level,
+		"message":        message,
+		"_marshal_error": marshalErr.Error(),
+	}
+}
+
+// Index sends a document to OpenSearch.
+func (c *Client) Index(ctx context.Context, doc interface{}) error {
+	return c.IndexTo(ctx, "", doc)
+}
+
+// IndexTo sends a document to a specific index.
+// If index is empty, the client's configured index is used.
+func (c *Client) IndexTo(ctx context.Context, index string, doc interface{}) error {
+	if index == "" {
+		index = c.IndexName()
+	}
+
+	data, err := c.encode(doc)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/%s/_doc", c.base(), index)
+	respBody, err := c.send(ctx, http.MethodPost, url, index, c.contentType, data)
+	if err != nil {
+		return err
+	}
+	return c.checkIndexResult(respBody)
+}
+
+// checkIndexResult validates an index response body when WithResponseValidation is set.
+func (c *Client) checkIndexResult(respBody []byte) error {
+	if !c.validateResponse {
+		return nil
+	}
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return &UnexpectedResultError{Result: string(respBody)}
+	}
+	if result.Result != "created" && result.Result != "updated" {
+		return &UnexpectedResultError{Result: result.Result}
+	}
+	return nil
+}
+
+// IndexExists reports whether index exists. If index is empty, the client's
+// index is checked.
+func (c *Client) IndexExists(ctx context.Context, index string) (bool, error) {
+	if index == "" {
+		index = c.IndexName()
+	}
+	url := fmt.Sprintf("%s/%s", c.base(), neturl.PathEscape(index))
+	_, err := c.send(ctx, http.MethodHead, url, index, c.contentType, nil)
+	var notFound *IndexNotFoundError
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// EnsureIndex creates index if it does not exist. If index is empty, the
+// client's index is used. An index created concurrently by another writer
+// counts as success. An existing alias (such as a rollover write alias) counts
+// as existing, so it is never shadowed by a concrete index of the same name.
+func (c *Client) EnsureIndex(ctx context.Context, index string) error {
+	if index == "" {
+		index = c.IndexName()
+	}
+	exists, err := c.IndexExists(ctx, index)
+	if err != nil || exists {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/%s", c.base(), neturl.PathEscape(index))
+	_, err = c.send(ctx, http.MethodPut, url, index, "application/json", nil)
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) && (strings.Contains(queryErr.Error(), "resource_already_exists_exception") ||
+		strings.Contains(queryErr.Error(), "an alias with the same name already exists")) {
+		return nil
+	}
+	return err
+}
+
+// EnsureIndexTemplate creates or replaces the composable index template name
+// (PUT _index_template/{name}), so applications can provision their mappings
+// on startup. template is the request body, e.g.
+//
+//	map[string]interface{}{
+//		"index_patterns": []string{"devlogs-*"},
+//		"template": map[string]interface{}{"mappings": mappings},
+//	}
+//
+// Putting the same template again is a no-op, so it is safe to call on every start.
+func (c *Client) EnsureIndexTemplate(ctx context.Context, name string, template map[string]interface{}) error {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index template: %w", err)
+	}
+	url := fmt.Sprintf("%s/_index_template/%s", c.base(), neturl.PathEscape(name))
+	_, err = c.send(ctx, http.MethodPut, url, name, "application/json", data)
+	return err
+}
+
+// ResolveWriteIndex returns the concrete index that writes to the client's
+// index go to. Config.Index may name an alias, such as a write alias managed
+// by ISM rollover; the backing index marked as the write index is returned,
+// or the only backing index if none is marked. If the name is not an alias it
+// is returned unchanged.
+func (c *Client) ResolveWriteIndex(ctx context.Context) (string, error) {
+	name := c.IndexName()
+	url := fmt.Sprintf("%s/_alias/%s", c.base(), neturl.PathEscape(name))
+	respBody, err := c.send(ctx, http.MethodGet, url, name, "application/json", nil)
+	var notFound *IndexNotFoundError
+	if errors.As(err, &notFound) {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// {"<backing index>": {"aliases": {"<alias>": {"is_write_index": true}}}}
+	var result map[string]struct {
+		Aliases map[string]struct {
+			IsWriteIndex *bool `json:"is_write_index"`
+		} `json:"aliases"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", NewQueryError(fmt.Sprintf("invalid alias response: %v", err))
+	}
+
+	var backing []string
+	for index, entry := range result {
+		alias, ok := entry.Aliases[name]
+		if !ok {
+			continue
+		}
+		if alias.IsWriteIndex != nil && *alias.IsWriteIndex {
+			return index, nil
+		}
+		backing = append(backing, index)
+	}
+	switch len(backing) {
+	case 0:
+		return name, nil
+	case 1:
+		return backing[0], nil
+	default:
+		sort.Strings(backing)
+		return "", NewQueryError(fmt.Sprintf("alias '%s' points to %d indices and none is the write index: %s",
+			name, len(backing), strings.Join(backing, ", ")))
+	}
+}
+
+// Bootstrap provisions the client's index for writing, so services need not
+// repeat the setup on every start. With Config.UseDataStream it puts an index
+// template matching the name with data streams enabled, then creates the data
+// stream. Otherwise it puts a template for name-* that sets the ISM rollover
+// alias, then creates name-000001 with name as its write alias. Each step is
+// skipped or tolerated if it already exists, so Bootstrap is idempotent; what
+// it creates is reported through WithClientSelfLogging, or on stderr.
+func (c *Client) Bootstrap(ctx context.Context) error {
+	name := c.IndexName()
+	if c.dataStream() {
+		template := map[string]interface{}{
+			"index_patterns": []string{name},
+			"data_stream": map[string]interface{}{
+				"timestamp_field": map[string]string{"name": "timestamp"},
+			},
+		}
+		if err := c.EnsureIndexTemplate(ctx, name, template); err != nil {
+			return err
+		}
+		url := fmt.Sprintf("%s/_data_stream/%s", c.base(), neturl.PathEscape(name))
+		_, err := c.send(ctx, http.MethodPut, url, name, "application/json", nil)
+		if alreadyExists(err) {
+			return nil
+		}
+		if err == nil {
+			selfLog(c.logger, slog.LevelInfo, fmt.Sprintf("Created data stream %s", name))
+		}
+		return err
+	}
+
+	template := map[string]interface{}{
+		"index_patterns": []string{name + "-*"},
+		"template": map[string]interface{}{
+			"settings": map[string]string{"plugins.index_state_management.rollover_alias": name},
+		},
+	}
+	if err := c.EnsureIndexTemplate(ctx, name, template); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/_alias/%s", c.base(), neturl.PathEscape(name))
+	_, err := c.send(ctx, http.MethodHead, url, name, c.contentType, nil)
+	var notFound *IndexNotFoundError
+	if !errors.As(err, &notFound) {
+		// The alias exists, or the check itself failed
+		return err
+	}
+
+	initial := name + "-000001"
+	body, err := json.Marshal(map[string]interface{}{
+		"aliases": map[string]interface{}{
+			name: map[string]bool{"is_write_index": true},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal initial index: %w", err)
+	}
+	url = fmt.Sprintf("%s/%s", c.base(), neturl.PathEscape(initial))
+	_, err = c.send(ctx, http.MethodPut, url, initial, "application/json", body)
+	if alreadyExists(err) {
+		return nil
+	}
+	if err == nil {
+		selfLog(c.logger, slog.LevelInfo, fmt.Sprintf("Created index %s with write alias %s", initial, name))
+	}
+	return err
+}
+
+// alreadyExists reports whether err is OpenSearch refusing to create a
+// resource that another writer already created.
+func alreadyExists(err error) bool {
+	var queryErr *QueryError
+	return errors.As(err, &queryErr) && strings.Contains(queryErr.Error(), "resource_already_exists_exception")
+}
+
+// IndexWithID writes a document with an explicit _id, replacing any existing
+// document with the same ID. If index is empty, the client's index is used.
+// Data streams only accept creates, so with Config.UseDataStream the document
+// is created instead and an existing ID is rejected.
+func (c *Client) IndexWithID(ctx context.Context, index, id string, doc interface{}) error {
+	if index == "" {
+		index = c.IndexName()
+	}
+
+	data, err := c.encode(doc)
+	if err != nil {
+		return err
+	}
+
+	// Data streams accept only create operations
+	endpoint := "_doc"
+	if c.dataStream() {
+		endpoint = "_create"
+	}
+	url := fmt.Sprintf("%s/%s/%s/%s", c.base(), index, endpoint, neturl.PathEscape(id))
+	respBody, err := c.send(ctx, http.MethodPut, url, index, c.contentType, data)
+	if err != nil {
+		return err
+	}
+	return c.checkIndexResult(respBody)
+}
+
+// BulkItem is a single document in a bulk request.
+type BulkItem struct {
+	// Index is the target index. If empty, the client's index is used.
+	Index string
+	// ID is the document _id. If set, an existing document with the same ID is replaced.
+	ID       string
+	Document interface{}
+}
+
+// Bulk sends multiple documents to OpenSearch in a single _bulk request.
+func (c *Client) Bulk(ctx context.Context, items []BulkItem) error {
+	var body bytes.Buffer
+	for _, item := range items {
+		line, err := c.encodeBulkItem(item)
+		if err != nil {
+			return err
+		}
+		body.Write(line)
+	}
+	_, err := c.sendBulk(ctx, body.Bytes())
+	return err
+}
+
+// encodeBulkItem encodes an item as an action line followed by a source line.
+func (c *Client) encodeBulkItem(item BulkItem) ([]byte, error) {
+	index := item.Index
+	if index == "" {
+		index = c.IndexName()
+	}
+	meta := map[string]string{"_index": index}
+	if item.ID != "" {
+		meta["_id"] = item.ID
+	}
+	// Data streams accept only create actions
+	op := "index"
+	if c.dataStream() {
+		op = "create"
+	}
+	action, err := json.Marshal(map[string]interface{}{
+		op: meta,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bulk action: %w", err)
+	}
+	source, err := c.encode(item.Document)
+	if err != nil {
+		return nil, err
+	}
+
+	line := make([]byte, 0, len(action)+len(source)+2)
+	line = append(line, action...)
+	line = append(line, '\n')
+	line = append(line, source...)
+	line = append(line, '\n')
+	return line, nil
+}
+
+// FailedItem is a document OpenSearch rejected within an otherwise successful
+// bulk request.
+type FailedItem struct {
+	Item BulkItem
+	// Status is the item's HTTP status, e.g. 400 for a mapping conflict or 429 when rejected.
+	Status int
+	// Reason is the error type and reason reported by OpenSearch.
+	Reason string
+}
+
+// bulkFailure is a rejected item by its position in the bulk request.
+type bulkFailure struct {
+	pos    int
+	status int
+	reason string
+}
+
+// sendBulk posts an encoded NDJSON body to the _bulk endpoint. When some items
+// are rejected it returns a *QueryError along with the rejected items.
+func (c *Client) sendBulk(ctx context.Context, body []byte) ([]bulkFailure, error) {
+	url := fmt.Sprintf("%s/_bulk", c.base())
+	respBody, err := c.send(ctx, http.MethodPost, url, c.IndexName(), "application/x-ndjson", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil || !result.Errors {
+		return nil, nil
+	}
+
+	var failures []bulkFailure
+	for pos, item := range result.Items {
+		// Each item has a single key naming its action
+		for _, res := range item {
+			if res.Error != nil {
+				failures = append(failures, bulkFailure{
+					pos:    pos,
+					status: res.Status,
+					reason: res.Error.Type + ": " + res.Error.Reason,
+				})
+			}
+		}
+	}
+	return failures, NewQueryError(fmt.Sprintf("bulk request had item failures: %s", string(respBody)))
+}
+
+// Ping checks that OpenSearch is reachable and accepts the configured credentials.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.send(ctx, http.MethodGet, c.base()+"/", c.IndexName(), "application/json", nil)
+	return err
+}
+
+// SearchRequest describes a search against the client's index.
+type SearchRequest struct {
+	// Query is an OpenSearch query DSL object. If nil, all documents match.
+	Query map[string]interface{}
+	// Size is the maximum number of hits to return (0 uses the server default).
+	Size int
+	// Sort is an OpenSearch sort specification.
+	Sort []interface{}
+
+	// PITID searches a point in time opened with OpenPIT instead of the
+	// client's index, so pages stay consistent while new logs arrive.
+	PITID string
+	// KeepAlive extends the point in time by this long (0 keeps the server default).
+	KeepAlive time.Duration
+	// SearchAfter resumes after the Sort values of the previous page's last hit.
+	SearchAfter []interface{}
+}
+
+// SearchHit is a single document returned by Search.
+type SearchHit struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+	Sort   []interface{}   `json:"sort,omitempty"`
+}
+
+// SearchResponse holds the hits returned by Search.
+type SearchResponse struct {
+	Total int
+	Hits  []SearchHit
+	// PITID is the point in time to use for the next page, when searching one.
+	PITID string
+}
+
+// Search runs a query against the client's index.
+func (c *Client) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	body := map[string]interface{}{}
+	if req.Query != nil {
+		body["query"] = req.Query
+	}
+	if req.Size > 0 {
+		body["size"] = req.Size
+	}
+	if len(req.Sort) > 0 {
+		body["sort"] = req.Sort
+	}
+	if len(req.SearchAfter) > 0 {
+		body["search_after"] = req.SearchAfter
+	}
+
+	// A point in time already names its indices, so the path has none
+	index := c.IndexName()
+	url := fmt.Sprintf("%s/%s/_search", c.base(), index)
+	if req.PITID != "" {
+		pit := map[string]interface{}{"id": req.PITID}
+		if req.KeepAlive > 0 {
+			pit["keep_alive"] = formatKeepAlive(req.KeepAlive)
+		}
+		body["pit"] = pit
+		url = c.base() + "/_search"
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal search request: %w", err)
+	}
+
+	respBody, err := c.send(ctx, http.MethodPost, url, index, "application/json", data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		PITID string `json:"pit_id"`
+		Hits  struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []SearchHit `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, NewQueryError(fmt.Sprintf("invalid search response: %v", err))
+	}
+
+	return &SearchResponse{
+		Total: result.Hits.Total.Value,
+		Hits:  result.Hits.Hits,
+		PITID: result.PITID,
+	}, nil
+}
+
+// OpenPIT opens a point in time on the client's index for consistent paging
+// with Search. Close it with ClosePIT when done.
+func (c *Client) OpenPIT(ctx context.Context, keepAlive time.Duration) (string, error) {
+	index := c.IndexName()
+	url := fmt.Sprintf("%s/%s/_search/point_in_time?keep_alive=%s",
+		c.base(), index, neturl.QueryEscape(formatKeepAlive(keepAlive)))
+	respBody, err := c.send(ctx, http.MethodPost, url, index, "application/json", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		PITID string `json:"pit_id"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil || result.PITID == "" {
+		return "", NewQueryError(fmt.Sprintf("invalid point in time response: %s", respBody))
+	}
+	return result.PITID, nil
+}
+
+// ClosePIT releases a point in time opened with OpenPIT.
+func (c *Client) ClosePIT(ctx context.Context, pitID string) error {
+	data, err := json.Marshal(map[string]interface{}{"pit_id": []string{pitID}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal point in time request: %w", err)
+	}
+	url := c.base() + "/_search/point_in_time"
+	_, err = c.send(ctx, http.MethodDelete, url, c.IndexName(), "application/json", data)
+	return err
+}
+
+// formatKeepAlive renders a duration in OpenSearch time units.
+func formatKeepAlive(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// newRequest builds a request with the client's headers. authHeader is the
+// precomputed Authorization value, so the hot path never re-encodes credentials.
+func (c *Client) newRequest(ctx context.Context, method, url, authHeader, contentType string, data []byte, compressed bool) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", c.userAgent)
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Authorization", authHeader)
+	req.Header.Set("Content-Type", contentType)
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, nil
+}
+
+// send performs a request and maps the response status to devlogs errors.
+// index is only used to describe a 404 response.
+func (c *Client) send(ctx context.Context, method, url, index, contentType string, data []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok && c.contextTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.contextTimeout)
+		defer cancel()
+	}
+
+	if c.chaos != nil {
+		if err := c.chaos(); err != nil {
+			return nil, err
+		}
+	}
+	if c.chaosDelay > 0 {
+		select {
+		case <-time.After(c.chaosDelay):
+		case <-ctx.Done():
+			return nil, NewConnectionError(fmt.Sprintf("request to OpenSearch at %s was interrupted", c.base()), ctx.Err())
+		}
+	}
+
+	compressed := false
+	if c.compress && len(data) > 0 && len(data) > c.compressionThreshold {
+		gz, err := gzipBytes(data, c.compressionLevel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress request: %w", err)
+		}
+		data = gz
+		compressed = true
+	}
+
+	c.connMu.RLock()
+	baseURL, authHeader, httpClient := c.baseURL, c.authHeader, c.httpClient
+	c.connMu.RUnlock()
+
+	req, err := c.newRequest(ctx, method, url, authHeader, contentType, data, compressed)
+	if err != nil {
+		return nil, NewConnectionError("failed to create request", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return nil, NewConnectionError(fmt.Sprintf("request to OpenSearch at %s timed out", baseURL), err)
+		case errors.Is(ctx.Err(), context.Canceled):
+			return nil, NewConnectionError(fmt.Sprintf("request to OpenSearch at %s was canceled", baseURL), err)
+		}
+		return nil, NewConnectionError(fmt.Sprintf("cannot connect to OpenSearch at %s", baseURL), err)
+	}
+	defer resp.Body.Close()
+
+	// Read body for error messages
+	body, _ := io.ReadAll(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return body, nil
+	case http.StatusUnauthorized:
+		return nil, NewAuthError("authentication failed (HTTP 401)")
+	case http.StatusNotFound:
+		return nil, NewIndexNotFoundError(index)
+	case http.StatusBadRequest:
+		return nil, NewQueryError(fmt.Sprintf("bad request: %s", string(body)))
+	case http.StatusRequestEntityTooLarge:
+		return nil, NewPayloadTooLargeError(len(data))
+	default:
+		return nil, NewConnectionError(
+			fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, string(body)),
+			nil,
+		)
+	}
+}
+
+// gzipBytes compresses data at the given gzip level.
+func gzipBytes(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// IndexName returns the configured index name.
+func (c *Client) IndexName() string {
+	c.indexMu.RLock()
+	defer c.indexMu.RUnlock()
+	return c.indexName
+}
+
+// dataStream reports whether the client writes to a data stream.
+func (c *Client) dataStream() bool {
+	c.indexMu.RLock()
+	defer c.indexMu.RUnlock()
+	return c.useDataStream
+}
+
+// SetIndex changes the default index for subsequent requests, e.g. to redirect
+// logs to a scratch index during an incident. Requests already started keep
+// the index they resolved when they began.
+func (c *Client) SetIndex(name string) {
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	c.indexName = name
+}
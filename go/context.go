@@ -1,91 +1,217 @@
-package devlogs
-
-import (
-	"context"
-	"crypto/rand"
-	"fmt"
-	"sync"
-)
-
-type contextKey string
-
-const (
-	operationIDKey contextKey = "devlogs_operation_id"
-	areaKey        contextKey = "devlogs_area"
-)
-
-var (
-	globalArea   string
-	globalAreaMu sync.RWMutex
-)
-
-// WithOperation returns a new context with operation_id and area set.
-// If operationID is empty, generates a new UUID.
-// If area is empty, preserves existing area from context or uses global area.
-func WithOperation(ctx context.Context, operationID, area string) context.Context {
-	if operationID == "" {
-		operationID = generateUUID()
-	}
-	ctx = context.WithValue(ctx, operationIDKey, operationID)
-	if area != "" {
-		ctx = context.WithValue(ctx, areaKey, area)
-	}
-	return ctx
-}
-
-// WithOperationID returns a context with only operation_id set.
-func WithOperationID(ctx context.Context, operationID string) context.Context {
-	if operationID == "" {
-		operationID = generateUUID()
-	}
-	return context.WithValue(ctx, operationIDKey, operationID)
-}
-
-// WithArea returns a context with area set.
-func WithArea(ctx context.Context, area string) context.Context {
-	return context.WithValue(ctx, areaKey, area)
-}
-
-// GetOperationID retrieves the operation_id from context.
-func GetOperationID(ctx context.Context) string {
-	if v := ctx.Value(operationIDKey); v != nil {
-		if s, ok := v.(string); ok {
-			return s
-		}
-	}
-	return ""
-}
-
-// GetArea retrieves the area from context, falling back to global area.
-func GetArea(ctx context.Context) string {
-	if v := ctx.Value(areaKey); v != nil {
-		if s, ok := v.(string); ok && s != "" {
-			return s
-		}
-	}
-	return GetGlobalArea()
-}
-
-// SetArea sets the global area for all contexts.
-func SetArea(area string) {
-	globalAreaMu.Lock()
-	defer globalAreaMu.Unlock()
-	globalArea = area
-}
-
-// GetGlobalArea returns the current global area.
-func GetGlobalArea() string {
-	globalAreaMu.RLock()
-	defer globalAreaMu.RUnlock()
-	return globalArea
-}
-
-// generateUUID generates a random UUID v4.
-func generateUUID() string {
-	var uuid [16]byte
-	_, _ = rand.Read(uuid[:])
-	uuid[6] = (uuid[6] & 0x0f) | 0x40 // Version 4
-	uuid[8] = (uuid[8] & 0x3f) | 0x80 // Variant 10
-	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
-		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
-}
+package devlogs
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+type contextKey string
+
+const (
+	operationIDKey    contextKey = "devlogs_operation_id"
+	areaKey           contextKey = "devlogs_area"
+	operationStartKey contextKey = "devlogs_operation_start"
+	correlationsKey   contextKey = "devlogs_correlations"
+	operationStackKey contextKey = "devlogs_operation_stack"
+)
+
+var (
+	globalArea   string
+	globalAreaMu sync.RWMutex
+)
+
+// WithOperation returns a new context with operation_id and area set.
+// If operationID is empty, generates a new UUID.
+// If area is empty, preserves existing area from context or uses global area.
+func WithOperation(ctx context.Context, operationID, area string) context.Context {
+	if operationID == "" {
+		operationID = generateUUID()
+	}
+	ctx = context.WithValue(ctx, operationIDKey, operationID)
+	if area != "" {
+		ctx = context.WithValue(ctx, areaKey, area)
+	}
+	return ctx
+}
+
+// StartOperation records the start time of an operation in the returned context,
+// generating an operation_id if ctx has none. Call finish when the operation
+// ends; it logs "operation completed" through slog.Default with duration_ms and
+// a status of "ok", or "error" plus the error when err is non-nil.
+//
+//	ctx, finish := devlogs.StartOperation(ctx)
+//	err := handle(ctx)
+//	finish(err)
+func StartOperation(ctx context.Context) (context.Context, func(err error)) {
+	if GetOperationID(ctx) == "" {
+		ctx = WithOperationID(ctx, "")
+	}
+	start := time.Now()
+	ctx = context.WithValue(ctx, operationStartKey, start)
+
+	finish := func(err error) {
+		attrs := []slog.Attr{
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			slog.String("status", "ok"),
+		}
+		level := slog.LevelInfo
+		if err != nil {
+			attrs[1] = slog.String("status", "error")
+			attrs = append(attrs, slog.String("error", err.Error()))
+			level = slog.LevelError
+		}
+		slog.Default().LogAttrs(ctx, level, "operation completed", attrs...)
+	}
+	return ctx, finish
+}
+
+// GetOperationStart returns when the operation in ctx was started with
+// StartOperation, or the zero time.
+func GetOperationStart(ctx context.Context) time.Time {
+	start, _ := ctx.Value(operationStartKey).(time.Time)
+	return start
+}
+
+// WithOperationID returns a context with only operation_id set.
+func WithOperationID(ctx context.Context, operationID string) context.Context {
+	if operationID == "" {
+		operationID = generateUUID()
+	}
+	return context.WithValue(ctx, operationIDKey, operationID)
+}
+
+// WithArea returns a context with area set.
+func WithArea(ctx context.Context, area string) context.Context {
+	return context.WithValue(ctx, areaKey, area)
+}
+
+// WithCorrelation returns a context carrying an extra correlation ID such as
+// trace_id, tenant_id or session_id. Every document logged with the context
+// gets the value as a field (or top-level key, see WithTopLevelCorrelations).
+// Setting a key again replaces its value; an empty value removes it.
+func WithCorrelation(ctx context.Context, key, value string) context.Context {
+	existing, _ := ctx.Value(correlationsKey).(map[string]string)
+	// Copy so contexts derived earlier keep their own values
+	correlations := make(map[string]string, len(existing)+1)
+	for k, v := range existing {
+		correlations[k] = v
+	}
+	if value == "" {
+		delete(correlations, key)
+	} else {
+		correlations[key] = value
+	}
+	return context.WithValue(ctx, correlationsKey, correlations)
+}
+
+// GetCorrelations returns a copy of the correlation IDs in ctx, or nil if none are set.
+func GetCorrelations(ctx context.Context) map[string]string {
+	correlations, _ := ctx.Value(correlationsKey).(map[string]string)
+	if len(correlations) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(correlations))
+	for k, v := range correlations {
+		out[k] = v
+	}
+	return out
+}
+
+// PushOperation returns a context whose operation stack has name appended.
+// Documents logged with the context carry the stack, outermost first, as
+// operation_stack, giving a breadcrumb of nested operations:
+//
+//	ctx = devlogs.PushOperation(ctx, "checkout")
+//	ctx = devlogs.PushOperation(ctx, "charge-card")
+//	// operation_stack: ["checkout", "charge-card"]
+func PushOperation(ctx context.Context, name string) context.Context {
+	existing, _ := ctx.Value(operationStackKey).([]string)
+	// Copy so sibling operations pushed on the same parent don't share storage
+	stack := make([]string, len(existing), len(existing)+1)
+	copy(stack, existing)
+	return context.WithValue(ctx, operationStackKey, append(stack, name))
+}
+
+// GetOperationStack returns a copy of the operation stack in ctx, outermost
+// first, or nil if no operation was pushed.
+func GetOperationStack(ctx context.Context) []string {
+	stack, _ := ctx.Value(operationStackKey).([]string)
+	if len(stack) == 0 {
+		return nil
+	}
+	return append([]string(nil), stack...)
+}
+
+// GetOperationID retrieves the operation_id from context.
+func GetOperationID(ctx context.Context) string {
+	if v := ctx.Value(operationIDKey); v != nil {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// GetArea retrieves the area from context, falling back to global area.
+func GetArea(ctx context.Context) string {
+	if v := ctx.Value(areaKey); v != nil {
+		if s, ok := v.(string); ok && s != "" {
+			return s
+		}
+	}
+	return GetGlobalArea()
+}
+
+// ResolveArea returns the area for a log record. The first non-empty value wins:
+//
+//  1. the area in ctx (WithArea, WithOperation)
+//  2. the handler's default area (WithDefaultArea), if h is non-nil
+//  3. the global area (SetArea)
+//  4. the DEVLOGS_AREA environment variable, as read when h was built, or
+//     now if h is nil
+func ResolveArea(ctx context.Context, h *Handler) string {
+	if v := ctx.Value(areaKey); v != nil {
+		if s, ok := v.(string); ok && s != "" {
+			return s
+		}
+	}
+	if h != nil && h.defaultArea != "" {
+		return h.defaultArea
+	}
+	if area := GetGlobalArea(); area != "" {
+		return area
+	}
+	if h != nil {
+		return h.envArea
+	}
+	return os.Getenv("DEVLOGS_AREA")
+}
+
+// SetArea sets the global area for all contexts.
+func SetArea(area string) {
+	globalAreaMu.Lock()
+	defer globalAreaMu.Unlock()
+	globalArea = area
+}
+
+// GetGlobalArea returns the current global area.
+func GetGlobalArea() string {
+	globalAreaMu.RLock()
+	defer globalAreaMu.RUnlock()
+	return globalArea
+}
+
+// generateUUID generates a random UUID v4.
+func generateUUID() string {
+	var uuid [16]byte
+	_, _ = rand.Read(uuid[:])
+	uuid[6] = (uuid[6] & 0x0f) | 0x40 // Version 4
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // Variant 10
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
@@ -0,0 +1,138 @@
+package devlogs
+
+import (
+	"container/list"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxDedupKeys bounds how many distinct records the deduper tracks at once.
+const maxDedupKeys = 1000
+
+// deduper suppresses identical records (same message, level and area) within a
+// window. The first record of a window is sent right away; repeats are held
+// back, and when the window ends the first repeat is sent with a dedup_count
+// field recording how many times the record occurred in the window.
+type deduper struct {
+	window time.Duration
+	emit   func(doc *LogDocument, index string, level slog.Level)
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// dedupEntry tracks a window. doc is the first suppressed repeat, nil until
+// one arrives, and count is the number of occurrences, including the first.
+type dedupEntry struct {
+	key   string
+	doc   *LogDocument
+	index string
+	level slog.Level
+	count int
+	timer *time.Timer
+}
+
+func newDeduper(window time.Duration, emit func(doc *LogDocument, index string, level slog.Level)) *deduper {
+	return &deduper{
+		window:  window,
+		emit:    emit,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// dedupKey identifies records that count as duplicates.
+func dedupKey(doc *LogDocument) string {
+	area := ""
+	if doc.Area != nil {
+		area = *doc.Area
+	}
+	return doc.Level + "\x00" + area + "\x00" + doc.Message
+}
+
+// add records an occurrence of doc and reports whether it is the first of its
+// window, which the caller sends. Otherwise the deduper takes ownership of doc.
+func (d *deduper) add(doc *LogDocument, index string, level slog.Level) bool {
+	key := dedupKey(doc)
+
+	d.mu.Lock()
+	if elem, ok := d.entries[key]; ok {
+		entry := elem.Value.(*dedupEntry)
+		if entry.doc == nil {
+			// Keep a repeat rather than the first record, which is already sending
+			entry.doc, entry.index, entry.level = doc, index, level
+		}
+		entry.count++
+		d.lru.MoveToFront(elem)
+		d.mu.Unlock()
+		return false
+	}
+
+	// Evict the least recently seen record to bound memory
+	var evicted *dedupEntry
+	if d.lru.Len() >= maxDedupKeys {
+		evicted = d.removeLocked(d.lru.Back())
+	}
+
+	entry := &dedupEntry{key: key, count: 1}
+	d.entries[key] = d.lru.PushFront(entry)
+	entry.timer = time.AfterFunc(d.window, func() {
+		d.expire(key)
+	})
+	d.mu.Unlock()
+
+	if evicted != nil {
+		d.send(evicted)
+	}
+	return true
+}
+
+// expire sends the summary for key when its window ends.
+func (d *deduper) expire(key string) {
+	d.mu.Lock()
+	elem, ok := d.entries[key]
+	if !ok {
+		d.mu.Unlock()
+		return
+	}
+	entry := d.removeLocked(elem)
+	d.mu.Unlock()
+
+	d.send(entry)
+}
+
+// flush sends all pending summaries immediately.
+func (d *deduper) flush() {
+	d.mu.Lock()
+	var entries []*dedupEntry
+	for d.lru.Len() > 0 {
+		entries = append(entries, d.removeLocked(d.lru.Back()))
+	}
+	d.mu.Unlock()
+
+	for _, entry := range entries {
+		d.send(entry)
+	}
+}
+
+// removeLocked removes an entry and stops its timer. Caller holds d.mu.
+func (d *deduper) removeLocked(elem *list.Element) *dedupEntry {
+	entry := d.lru.Remove(elem).(*dedupEntry)
+	delete(d.entries, entry.key)
+	entry.timer.Stop()
+	return entry
+}
+
+// send emits the summary of a window, if any repeats were suppressed.
+func (d *deduper) send(entry *dedupEntry) {
+	if entry.doc == nil {
+		return
+	}
+	if entry.doc.Fields == nil {
+		entry.doc.Fields = make(map[string]interface{}, 1)
+	}
+	entry.doc.Fields["dedup_count"] = entry.count
+	d.emit(entry.doc, entry.index, entry.level)
+}
@@ -1,28 +1,72 @@
-// Package devlogs provides a logging handler that sends logs to OpenSearch.
-//
-// It integrates with Go's log/slog package and provides operation correlation,
-// circuit breaker protection, and automatic context propagation.
-//
-// Basic usage:
-//
-//	cfg, err := devlogs.LoadConfig()
-//	if err != nil {
-//	    log.Fatal(err)
-//	}
-//
-//	handler, err := devlogs.NewHandler(cfg)
-//	if err != nil {
-//	    log.Fatal(err)
-//	}
-//
-//	slog.SetDefault(slog.New(handler))
-//	slog.Info("Application started")
-//
-// With operation context:
-//
-//	ctx := devlogs.WithOperation(context.Background(), "req-123", "api")
-//	slog.InfoContext(ctx, "Request received", "path", "/users")
-package devlogs
-
-// Version is the library version.
-const Version = "2.0.2"
+// Package devlogs provides a logging handler that sends logs to OpenSearch.
+//
+// It integrates with Go's log/slog package and provides operation correlation,
+// circuit breaker protection, and automatic context propagation.
+//
+// Basic usage:
+//
+//	cfg, err := devlogs.LoadConfig()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+//	handler, err := devlogs.NewHandler(cfg)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+//	slog.SetDefault(slog.New(handler))
+//	slog.Info("Application started")
+//
+// Or, in one call:
+//
+//	cleanup, err := devlogs.Setup()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer cleanup()
+//
+// With operation context:
+//
+//	ctx := devlogs.WithOperation(context.Background(), "req-123", "api")
+//	slog.InfoContext(ctx, "Request received", "path", "/users")
+package devlogs
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Version is the library version.
+const Version = "2.0.2"
+
+// SchemaVersion is the document schema version stamped on every document.
+const SchemaVersion = "2.0"
+
+// Setup loads the config from the environment, validates it, builds a handler
+// with opts and installs it as the slog default. The returned cleanup func
+// flushes and closes the handler and restores the previous default logger;
+// call it before the program exits so buffered records are not lost.
+func Setup(opts ...HandlerOption) (func(), error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	handler, err := NewHandler(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := slog.Default()
+	slog.SetDefault(slog.New(handler))
+	cleanup := func() {
+		slog.SetDefault(previous)
+		if err := handler.Close(); err != nil {
+			selfLog(handler.selfLogger, slog.LevelWarn, fmt.Sprintf("Failed to close handler: %v", err))
+		}
+	}
+	return cleanup, nil
+}
@@ -0,0 +1,70 @@
+package devlogs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// selfLogKey marks contexts used for devlogs' own diagnostics.
+type selfLogKey struct{}
+
+// selfLogging maps each diagnostics logger to a flag that is set while a
+// diagnostic is being written to it, so a diagnostic raised from inside that
+// logger falls back to stderr. Other loggers are unaffected.
+var selfLogging sync.Map // *slog.Logger -> *atomic.Bool
+
+// selfLog writes a devlogs diagnostic to logger, or to stderr when logger is nil.
+// Devlogs handlers ignore records logged this way, so routing diagnostics into
+// a devlogs-backed logger cannot feed failures back into itself.
+func selfLog(logger *slog.Logger, level slog.Level, msg string, attrs ...slog.Attr) {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "[devlogs] %s\n", msg)
+		return
+	}
+	guard, _ := selfLogging.LoadOrStore(logger, new(atomic.Bool))
+	busy := guard.(*atomic.Bool)
+	if !busy.CompareAndSwap(false, true) {
+		fmt.Fprintf(os.Stderr, "[devlogs] %s\n", msg)
+		return
+	}
+	defer busy.Store(false)
+
+	ctx := context.WithValue(context.Background(), selfLogKey{}, true)
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// isSelfLog reports whether ctx belongs to a devlogs diagnostic.
+func isSelfLog(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(selfLogKey{}) != nil
+}
+
+// leakGuard is referenced only by a Handler and its derived handlers, never by
+// their background goroutines, so its finalizer runs once the application
+// drops every handler (see WithLeakCheck).
+type leakGuard struct {
+	created time.Time
+}
+
+// reportLeak is called from the finalizer of a guard that was not disarmed.
+var reportLeak = func(created time.Time) {
+	selfLog(nil, slog.LevelWarn, fmt.Sprintf(
+		"Handler created %v ago was garbage collected without Close; its background goroutines leaked",
+		time.Since(created).Round(time.Second)))
+}
+
+func newLeakGuard() *leakGuard {
+	g := &leakGuard{created: time.Now()}
+	runtime.SetFinalizer(g, func(g *leakGuard) { reportLeak(g.created) })
+	return g
+}
+
+// disarm removes the finalizer once the handler is closed.
+func (g *leakGuard) disarm() {
+	runtime.SetFinalizer(g, nil)
+}
@@ -1,70 +1,140 @@
-package devlogs
-
-import "fmt"
-
-// OpenSearchError is the base error type for OpenSearch operations.
-type OpenSearchError struct {
-	Message string
-	Cause   error
-}
-
-func (e *OpenSearchError) Error() string {
-	if e.Cause != nil {
-		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
-	}
-	return e.Message
-}
-
-func (e *OpenSearchError) Unwrap() error {
-	return e.Cause
-}
-
-// ConnectionError indicates a connection failure to OpenSearch.
-type ConnectionError struct {
-	OpenSearchError
-}
-
-// NewConnectionError creates a new ConnectionError.
-func NewConnectionError(message string, cause error) *ConnectionError {
-	return &ConnectionError{
-		OpenSearchError: OpenSearchError{Message: message, Cause: cause},
-	}
-}
-
-// AuthError indicates authentication failure (HTTP 401).
-type AuthError struct {
-	OpenSearchError
-}
-
-// NewAuthError creates a new AuthError.
-func NewAuthError(message string) *AuthError {
-	return &AuthError{
-		OpenSearchError: OpenSearchError{Message: message},
-	}
-}
-
-// IndexNotFoundError indicates the index does not exist (HTTP 404).
-type IndexNotFoundError struct {
-	OpenSearchError
-}
-
-// NewIndexNotFoundError creates a new IndexNotFoundError.
-func NewIndexNotFoundError(indexName string) *IndexNotFoundError {
-	return &IndexNotFoundError{
-		OpenSearchError: OpenSearchError{
-			Message: fmt.Sprintf("index '%s' does not exist", indexName),
-		},
-	}
-}
-
-// QueryError indicates a malformed query (HTTP 400).
-type QueryError struct {
-	OpenSearchError
-}
-
-// NewQueryError creates a new QueryError.
-func NewQueryError(message string) *QueryError {
-	return &QueryError{
-		OpenSearchError: OpenSearchError{Message: message},
-	}
-}
+package devlogs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQueueFull is returned by Handle when the send queue is full and the
+// overflow policy is OverflowReject (see WithOverflowPolicy).
+var ErrQueueFull = errors.New("log queue is full")
+
+// OpenSearchError is the base error type for OpenSearch operations.
+type OpenSearchError struct {
+	Message string
+	Cause   error
+}
+
+func (e *OpenSearchError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+func (e *OpenSearchError) Unwrap() error {
+	return e.Cause
+}
+
+// ConnectionError indicates a connection failure to OpenSearch.
+type ConnectionError struct {
+	OpenSearchError
+}
+
+// NewConnectionError creates a new ConnectionError.
+func NewConnectionError(message string, cause error) *ConnectionError {
+	return &ConnectionError{
+		OpenSearchError: OpenSearchError{Message: message, Cause: cause},
+	}
+}
+
+// IsCanceled reports whether the request failed because its context was canceled.
+func (e *ConnectionError) IsCanceled() bool {
+	return errors.Is(e.Cause, context.Canceled)
+}
+
+// IsTimeout reports whether the request failed because its context deadline passed.
+func (e *ConnectionError) IsTimeout() bool {
+	return errors.Is(e.Cause, context.DeadlineExceeded)
+}
+
+// AuthError indicates authentication failure (HTTP 401).
+type AuthError struct {
+	OpenSearchError
+}
+
+// NewAuthError creates a new AuthError.
+func NewAuthError(message string) *AuthError {
+	return &AuthError{
+		OpenSearchError: OpenSearchError{Message: message},
+	}
+}
+
+// IndexNotFoundError indicates the index does not exist (HTTP 404).
+type IndexNotFoundError struct {
+	OpenSearchError
+}
+
+// NewIndexNotFoundError creates a new IndexNotFoundError.
+func NewIndexNotFoundError(indexName string) *IndexNotFoundError {
+	return &IndexNotFoundError{
+		OpenSearchError: OpenSearchError{
+			Message: fmt.Sprintf("index '%s' does not exist", indexName),
+		},
+	}
+}
+
+// QueryError indicates a malformed query (HTTP 400).
+type QueryError struct {
+	OpenSearchError
+}
+
+// NewQueryError creates a new QueryError.
+func NewQueryError(message string) *QueryError {
+	return &QueryError{
+		OpenSearchError: OpenSearchError{Message: message},
+	}
+}
+
+// PayloadTooLargeError indicates the request body exceeded the cluster's
+// http.max_content_length (HTTP 413).
+type PayloadTooLargeError struct {
+	OpenSearchError
+	// PayloadSize is the size in bytes of the rejected request body, after compression.
+	PayloadSize int
+}
+
+// NewPayloadTooLargeError creates a new PayloadTooLargeError.
+func NewPayloadTooLargeError(payloadSize int) *PayloadTooLargeError {
+	return &PayloadTooLargeError{
+		OpenSearchError: OpenSearchError{
+			Message: fmt.Sprintf("payload of %d bytes too large (HTTP 413); lower the batch size or "+
+				"WithBulkByteLimit below the cluster's http.max_content_length (default 100mb)", payloadSize),
+		},
+		PayloadSize: payloadSize,
+	}
+}
+
+// ShutdownTimeoutError indicates Close returned before all records were sent.
+type ShutdownTimeoutError struct {
+	// Undrained is the number of records that were still unsent.
+	Undrained int
+	Timeout   time.Duration
+}
+
+func (e *ShutdownTimeoutError) Error() string {
+	return fmt.Sprintf("shutdown timed out after %v with %d records unsent", e.Timeout, e.Undrained)
+}
+
+// ValidationError indicates a document is missing a required schema field.
+type ValidationError struct {
+	// Field is the JSON name of the offending field.
+	Field string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid document: %s is required", e.Field)
+}
+
+// UnexpectedResultError indicates OpenSearch acknowledged an index request
+// without creating or updating the document (see WithResponseValidation).
+type UnexpectedResultError struct {
+	// Result is the response's "result" value, e.g. "noop".
+	Result string
+}
+
+func (e *UnexpectedResultError) Error() string {
+	return fmt.Sprintf("document not indexed: unexpected result %q", e.Result)
+}
@@ -0,0 +1,87 @@
+package devlogs
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// FieldSizeStat aggregates the encoded sizes seen for one field.
+type FieldSizeStat struct {
+	// Samples is the number of sampled documents that carried the field.
+	Samples int
+	// TotalBytes is the summed JSON-encoded size of the field's values.
+	TotalBytes int
+	// MaxBytes is the largest JSON-encoded value seen.
+	MaxBytes int
+}
+
+// AvgBytes returns the mean encoded size per sample.
+func (s FieldSizeStat) AvgBytes() int {
+	if s.Samples == 0 {
+		return 0
+	}
+	return s.TotalBytes / s.Samples
+}
+
+// fieldSizeStats samples documents and aggregates per-field value sizes.
+type fieldSizeStats struct {
+	sampleEvery int64
+	seen        atomic.Int64
+
+	mu    sync.Mutex
+	stats map[string]FieldSizeStat
+}
+
+func newFieldSizeStats(sampleEvery int) *fieldSizeStats {
+	if sampleEvery < 1 {
+		sampleEvery = 1
+	}
+	return &fieldSizeStats{
+		sampleEvery: int64(sampleEvery),
+		stats:       make(map[string]FieldSizeStat),
+	}
+}
+
+// observe records field sizes for one in every sampleEvery documents.
+func (s *fieldSizeStats) observe(fields map[string]interface{}) {
+	if len(fields) == 0 || s.seen.Add(1)%s.sampleEvery != 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observeLocked("", fields)
+}
+
+// observeLocked records leaf values under their dotted path. Caller holds s.mu.
+func (s *fieldSizeStats) observeLocked(prefix string, fields map[string]interface{}) {
+	for k, v := range fields {
+		key := prefix + k
+		if nested, ok := v.(map[string]interface{}); ok {
+			s.observeLocked(key+".", nested)
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		stat := s.stats[key]
+		stat.Samples++
+		stat.TotalBytes += len(data)
+		if len(data) > stat.MaxBytes {
+			stat.MaxBytes = len(data)
+		}
+		s.stats[key] = stat
+	}
+}
+
+// snapshot returns a copy of the aggregated stats.
+func (s *fieldSizeStats) snapshot() map[string]FieldSizeStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]FieldSizeStat, len(s.stats))
+	for k, v := range s.stats {
+		out[k] = v
+	}
+	return out
+}
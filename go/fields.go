@@ -0,0 +1,437 @@
+package devlogs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the OpenSearch type a field value is coerced to.
+type FieldType int
+
+const (
+	// FieldTypeString stringifies the value.
+	FieldTypeString FieldType = iota + 1
+	// FieldTypeNumber converts the value to a float64.
+	FieldTypeNumber
+	// FieldTypeBool converts the value to a bool.
+	FieldTypeBool
+)
+
+// coerceFieldTypes converts values in fields to the types in types, in place.
+// Keys may be dotted paths into nested groups (e.g. "http.status").
+// Values that cannot be converted are removed so they cannot cause a mapping conflict.
+func coerceFieldTypes(fields map[string]interface{}, types map[string]FieldType) {
+	for path, fieldType := range types {
+		parent, key := lookupFieldParent(fields, path)
+		if parent == nil {
+			continue
+		}
+		value, ok := parent[key]
+		if !ok || value == nil {
+			continue
+		}
+		if coerced, ok := coerceValue(value, fieldType); ok {
+			parent[key] = coerced
+		} else {
+			delete(parent, key)
+		}
+	}
+}
+
+// lookupFieldParent returns the map holding the last segment of a dotted path.
+// An exact top-level key match takes precedence over a nested path.
+func lookupFieldParent(fields map[string]interface{}, path string) (map[string]interface{}, string) {
+	if _, ok := fields[path]; ok {
+		return fields, path
+	}
+	parts := strings.Split(path, ".")
+	current := fields
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return nil, ""
+		}
+		current = next
+	}
+	return current, parts[len(parts)-1]
+}
+
+// coerceValue converts value to fieldType, reporting whether it succeeded.
+func coerceValue(value interface{}, fieldType FieldType) (interface{}, bool) {
+	switch fieldType {
+	case FieldTypeString:
+		if s, ok := value.(string); ok {
+			return s, true
+		}
+		return fmt.Sprint(value), true
+	case FieldTypeNumber:
+		switch v := value.(type) {
+		case bool:
+			if v {
+				return float64(1), true
+			}
+			return float64(0), true
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return f, err == nil
+		}
+		if f, ok := numericValue(value); ok {
+			return f, true
+		}
+		return nil, false
+	case FieldTypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			return b, err == nil
+		}
+		if f, ok := numericValue(value); ok {
+			return f != 0, true
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+// numericValue converts any signed or unsigned integer or float, including
+// named types such as time.Month, to a float64.
+func numericValue(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// obfuscateIPs masks string values that are IP addresses, in place, recursing
+// into nested groups. Other values are left untouched.
+func obfuscateIPs(fields map[string]interface{}, v4Mask, v6Mask net.IPMask) {
+	for k, v := range fields {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			obfuscateIPs(value, v4Mask, v6Mask)
+		case string:
+			if masked, ok := maskIP(value, v4Mask, v6Mask); ok {
+				fields[k] = masked
+			}
+		}
+	}
+}
+
+// maskIP applies the matching mask if s is an IPv4 or IPv6 address.
+func maskIP(s string, v4Mask, v6Mask net.IPMask) (string, bool) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", false
+	}
+	if ip4 := ip.To4(); ip4 != nil && !strings.Contains(s, ":") {
+		return ip4.Mask(v4Mask).String(), true
+	}
+	return ip.To16().Mask(v6Mask).String(), true
+}
+
+// capFieldCount keeps the first max top-level fields in order and moves the rest
+// into an "_overflow" JSON string, marking the document with "_fields_truncated".
+// Keys missing from order are ranked after it, alphabetically.
+func capFieldCount(fields map[string]interface{}, order []string, max int) {
+	if len(fields) <= max {
+		return
+	}
+
+	ranked := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, k := range order {
+		if _, ok := fields[k]; ok && !seen[k] {
+			seen[k] = true
+			ranked = append(ranked, k)
+		}
+	}
+	var rest []string
+	for k := range fields {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	ranked = append(ranked, rest...)
+
+	overflow := make(map[string]interface{}, len(ranked)-max)
+	for _, k := range ranked[max:] {
+		overflow[k] = fields[k]
+		delete(fields, k)
+	}
+	if data, err := json.Marshal(overflow); err == nil {
+		fields["_overflow"] = string(data)
+	}
+	fields["_fields_truncated"] = true
+}
+
+// attrKeyOrder returns the top-level field keys of r in the order they were added,
+// inlining groups with an empty key the way addAttr does.
+func attrKeyOrder(r slog.Record) []string {
+	keys := make([]string, 0, r.NumAttrs())
+	var visit func(a slog.Attr)
+	visit = func(a slog.Attr) {
+		a.Value = a.Value.Resolve()
+		if a.Key == "" && a.Value.Kind() == slog.KindGroup {
+			for _, ga := range a.Value.Group() {
+				visit(ga)
+			}
+			return
+		}
+		keys = append(keys, a.Key)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		visit(a)
+		return true
+	})
+	return keys
+}
+
+// filterFields removes fields whose dotted path is not allowed, in place.
+// Allowing a group keeps all of it; allowing a path inside a group keeps only
+// that part of the group.
+func filterFields(fields map[string]interface{}, allowed map[string]bool, prefix string) {
+	for k, v := range fields {
+		path := prefix + k
+		if allowed[path] {
+			continue
+		}
+		nested, ok := v.(map[string]interface{})
+		if ok && allowsDescendant(allowed, path) {
+			filterFields(nested, allowed, path+".")
+			if len(nested) > 0 {
+				continue
+			}
+		}
+		delete(fields, k)
+	}
+}
+
+// allowsDescendant reports whether any allowed path lies inside group path.
+func allowsDescendant(allowed map[string]bool, path string) bool {
+	for p := range allowed {
+		if strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// numericTimeAttrs returns a copy of r with duration and/or time values,
+// including those nested in groups, replaced by int64 milliseconds.
+func numericTimeAttrs(r slog.Record, durations, times bool) slog.Record {
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		nr.AddAttrs(numericTimeAttr(a, durations, times))
+		return true
+	})
+	return nr
+}
+
+func numericTimeAttr(a slog.Attr, durations, times bool) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindDuration:
+		if durations {
+			return slog.Int64(a.Key, a.Value.Duration().Milliseconds())
+		}
+	case slog.KindTime:
+		if times {
+			return slog.Int64(a.Key, a.Value.Time().UnixMilli())
+		}
+	case slog.KindGroup:
+		group := a.Value.Group()
+		attrs := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			attrs[i] = numericTimeAttr(ga, durations, times)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(attrs...)}
+	case slog.KindAny:
+		// Durations and times passed via slog.Any keep their concrete type
+		switch v := a.Value.Any().(type) {
+		case time.Duration:
+			if durations {
+				return slog.Int64(a.Key, v.Milliseconds())
+			}
+		case time.Time:
+			if times {
+				return slog.Int64(a.Key, v.UnixMilli())
+			}
+		}
+	}
+	return a
+}
+
+// replaceAttrs returns a copy of r with replace applied to every attr that is
+// not a group, as slog.HandlerOptions.ReplaceAttr does. groups holds the keys
+// of the enclosing groups. Attrs replaced by the zero Attr are removed, and so
+// are groups left empty.
+func replaceAttrs(r slog.Record, replace func(groups []string, a slog.Attr) slog.Attr) slog.Record {
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		if a, ok := replaceAttr(nil, a, replace); ok {
+			nr.AddAttrs(a)
+		}
+		return true
+	})
+	return nr
+}
+
+func replaceAttr(groups []string, a slog.Attr, replace func([]string, slog.Attr) slog.Attr) (slog.Attr, bool) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		a = replace(groups, a)
+		return a, !a.Equal(slog.Attr{})
+	}
+
+	inner := groups
+	if a.Key != "" {
+		// Cap the slice so sibling groups cannot overwrite each other's path
+		inner = append(groups[:len(groups):len(groups)], a.Key)
+	}
+	var attrs []slog.Attr
+	for _, ga := range a.Value.Group() {
+		if ga, ok := replaceAttr(inner, ga, replace); ok {
+			attrs = append(attrs, ga)
+		}
+	}
+	if len(attrs) == 0 {
+		return slog.Attr{}, false
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(attrs...)}, true
+}
+
+// promoteCorrelations moves correlation IDs from doc.Fields to top-level keys.
+// A field only moves if it still holds the correlation value, so record attrs
+// sharing the key are left alone.
+func promoteCorrelations(doc *LogDocument, correlations map[string]string) {
+	for k, v := range correlations {
+		if documentKeys[k] || doc.Fields[k] != v {
+			continue
+		}
+		if doc.topLevel == nil {
+			doc.topLevel = make(map[string]string, len(correlations))
+		}
+		doc.topLevel[k] = v
+		delete(doc.Fields, k)
+	}
+	if len(doc.Fields) == 0 {
+		doc.Fields = nil
+	}
+}
+
+// renameFields renames keys found in renames, in place and at every depth.
+func renameFields(fields map[string]interface{}, renames map[string]string) {
+	for _, v := range fields {
+		if nested, ok := v.(map[string]interface{}); ok {
+			renameFields(nested, renames)
+		}
+	}
+	// Collect first; renaming while ranging could visit a renamed key again
+	var found []string
+	for k := range fields {
+		if to, ok := renames[k]; ok && to != k {
+			found = append(found, k)
+		}
+	}
+	for _, k := range found {
+		fields[renames[k]] = fields[k]
+		delete(fields, k)
+	}
+}
+
+// suffixFieldTypes appends the suffix for each value's kind to its key, in
+// place and at every depth, and returns the top-level renames. Keys already
+// ending with their suffix are kept. A key that would replace another field
+// gets a number before the suffix instead, e.g. "count_2_i".
+func suffixFieldTypes(fields map[string]interface{}, suffixes map[slog.Kind]string) map[string]string {
+	type move struct {
+		key, suffix string
+		value       interface{}
+	}
+	var moves []move
+	for k, v := range fields {
+		if nested, ok := v.(map[string]interface{}); ok {
+			suffixFieldTypes(nested, suffixes)
+			continue
+		}
+		suffix := suffixes[slog.AnyValue(v).Kind()]
+		if suffix != "" && !strings.HasSuffix(k, suffix) {
+			moves = append(moves, move{k, suffix, v})
+		}
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+
+	// Remove every moved key first, so one move never collides with a key
+	// that is about to move away; sort so collisions resolve the same way
+	sort.Slice(moves, func(i, j int) bool { return moves[i].key < moves[j].key })
+	for _, m := range moves {
+		delete(fields, m.key)
+	}
+	renames := make(map[string]string, len(moves))
+	for _, m := range moves {
+		key := m.key + m.suffix
+		for n := 2; ; n++ {
+			if _, taken := fields[key]; !taken {
+				break
+			}
+			key = fmt.Sprintf("%s_%d%s", m.key, n, m.suffix)
+		}
+		fields[key] = m.value
+		renames[m.key] = key
+	}
+	return renames
+}
+
+// templateToken matches the variable parts of a message: UUIDs and whole-word
+// numbers. Numbers inside identifiers such as "v2" or "http2" are left alone.
+var templateToken = regexp.MustCompile(
+	`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b|\b\d+(?:\.\d+)?\b`)
+
+// messageTemplate replaces the numbers and UUIDs in msg with "{}" and reports
+// whether it found any.
+func messageTemplate(msg string) (string, bool) {
+	template := templateToken.ReplaceAllLiteralString(msg, "{}")
+	return template, template != msg
+}
+
+// hashFields replaces the values of fields listed in keys, by bare key at any
+// depth or by dotted path, with the hex SHA-256 digest of salt and the value.
+// Groups are descended into rather than hashed.
+func hashFields(fields map[string]interface{}, keys map[string]bool, salt, prefix string) {
+	for k, v := range fields {
+		if nested, ok := v.(map[string]interface{}); ok {
+			hashFields(nested, keys, salt, prefix+k+".")
+			continue
+		}
+		if v != nil && (keys[k] || keys[prefix+k]) {
+			fields[k] = hashValue(salt, v)
+		}
+	}
+}
+
+// hashValue returns the hex SHA-256 digest of salt followed by v.
+func hashValue(salt string, v interface{}) string {
+	sum := sha256.Sum256([]byte(salt + fmt.Sprint(v)))
+	return hex.EncodeToString(sum[:])
+}
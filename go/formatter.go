@@ -1,198 +1,602 @@
-package devlogs
-
-import (
-	"bytes"
-	"context"
-	"log/slog"
-	"os"
-	"runtime"
-	"strconv"
-	"strings"
-	"time"
-)
-
-// LogSource contains source location info (v2.0 schema).
-type LogSource struct {
-	Logger   string  `json:"logger"`
-	Pathname *string `json:"pathname"`
-	LineNo   *int    `json:"lineno"`
-	FuncName *string `json:"funcName"`
-}
-
-// LogProcess contains process/thread info (v2.0 schema).
-type LogProcess struct {
-	ID     int `json:"id"`
-	Thread int `json:"thread"`
-}
-
-// LogDocument represents the document structure sent to OpenSearch (v2.0 schema).
-type LogDocument struct {
-	DocType string `json:"doc_type"`
-
-	// Required fields
-	Application string `json:"application"`
-	Component   string `json:"component"`
-	Timestamp   string `json:"timestamp"`
-
-	// Top-level log fields
-	Message string  `json:"message"`
-	Level   string  `json:"level"`
-	Area    *string `json:"area"`
-
-	// Optional metadata
-	Environment *string `json:"environment,omitempty"`
-	Version     *string `json:"version,omitempty"`
-	OperationID *string `json:"operation_id"`
-
-	// Custom fields (renamed from features)
-	Fields map[string]interface{} `json:"fields,omitempty"`
-
-	// Source and process info
-	Source    LogSource  `json:"source"`
-	Process   LogProcess `json:"process"`
-	Exception *string    `json:"exception,omitempty"`
-}
-
-// FormatLogDocument converts an slog.Record to a LogDocument using v2.0 schema.
-func FormatLogDocument(ctx context.Context, r slog.Record, cfg *Config) *LogDocument {
-	doc := &LogDocument{
-		DocType:     "log_entry",
-		Application: cfg.Application,
-		Component:   cfg.Component,
-		Timestamp:   r.Time.UTC().Format("2006-01-02T15:04:05.000Z"),
-		Message:     r.Message,
-		Level:       NormalizeLevel(r.Level),
-		Source: LogSource{
-			Logger: cfg.Component, // Use component as default logger name
-		},
-		Process: LogProcess{
-			ID:     os.Getpid(),
-			Thread: getGoroutineID(),
-		},
-	}
-
-	// Optional metadata
-	if cfg.Environment != "" {
-		doc.Environment = &cfg.Environment
-	}
-	if cfg.Version != "" {
-		doc.Version = &cfg.Version
-	}
-
-	// Extract source info
-	if r.PC != 0 {
-		frames := runtime.CallersFrames([]uintptr{r.PC})
-		frame, _ := frames.Next()
-		if frame.File != "" {
-			doc.Source.Pathname = &frame.File
-		}
-		if frame.Line > 0 {
-			doc.Source.LineNo = &frame.Line
-		}
-		if frame.Function != "" {
-			doc.Source.FuncName = &frame.Function
-			// Use function name as logger if available
-			doc.Source.Logger = frame.Function
-		}
-	}
-
-	// Get context values
-	if area := GetArea(ctx); area != "" {
-		doc.Area = &area
-	}
-	if opID := GetOperationID(ctx); opID != "" {
-		doc.OperationID = &opID
-	}
-
-	// Extract fields from record attributes (renamed from features)
-	fields := make(map[string]interface{})
-	r.Attrs(func(a slog.Attr) bool {
-		fields[a.Key] = resolveValue(a.Value)
-		return true
-	})
-	if len(fields) > 0 {
-		doc.Fields = fields
-	}
-
-	return doc
-}
-
-// resolveValue converts slog.Value to a JSON-serializable value.
-func resolveValue(v slog.Value) interface{} {
-	switch v.Kind() {
-	case slog.KindString:
-		return v.String()
-	case slog.KindInt64:
-		return v.Int64()
-	case slog.KindUint64:
-		return v.Uint64()
-	case slog.KindFloat64:
-		return v.Float64()
-	case slog.KindBool:
-		return v.Bool()
-	case slog.KindDuration:
-		return v.Duration().String()
-	case slog.KindTime:
-		return v.Time().Format(time.RFC3339)
-	case slog.KindGroup:
-		attrs := v.Group()
-		m := make(map[string]interface{}, len(attrs))
-		for _, a := range attrs {
-			m[a.Key] = resolveValue(a.Value)
-		}
-		return m
-	case slog.KindAny:
-		return v.Any()
-	default:
-		return v.String()
-	}
-}
-
-// getGoroutineID extracts the goroutine ID from runtime.Stack.
-func getGoroutineID() int {
-	var buf [64]byte
-	n := runtime.Stack(buf[:], false)
-	// Stack output starts with "goroutine <id> [...]"
-	s := string(buf[:n])
-	if strings.HasPrefix(s, "goroutine ") {
-		s = s[len("goroutine "):]
-		if idx := strings.IndexByte(s, ' '); idx > 0 {
-			if id, err := strconv.Atoi(s[:idx]); err == nil {
-				return id
-			}
-		}
-	}
-	return 0
-}
-
-// FormatException formats an error with stack trace for the exception field.
-func FormatException(err error) string {
-	if err == nil {
-		return ""
-	}
-
-	var buf bytes.Buffer
-	buf.WriteString(err.Error())
-	buf.WriteString("\n\nStack trace:\n")
-
-	// Get stack trace
-	var stack [32]uintptr
-	n := runtime.Callers(2, stack[:])
-	frames := runtime.CallersFrames(stack[:n])
-
-	for {
-		frame, more := frames.Next()
-		buf.WriteString("  ")
-		buf.WriteString(frame.Function)
-		buf.WriteString("\n    ")
-		buf.WriteString(frame.File)
-		buf.WriteString(":")
-		buf.WriteString(strconv.Itoa(frame.Line))
-		buf.WriteString("\n")
-		if !more {
-			break
-		}
-	}
-
-	return buf.String()
-}
+package devlogs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// LogSource contains source location info (v2.0 schema).
+type LogSource struct {
+	Logger   string  `json:"logger"`
+	Pathname *string `json:"pathname"`
+	LineNo   *int    `json:"lineno"`
+	FuncName *string `json:"funcName"`
+}
+
+// LogProcess contains process/thread info (v2.0 schema).
+type LogProcess struct {
+	ID     int `json:"id"`
+	Thread int `json:"thread"`
+}
+
+// LogDocument represents the document structure sent to OpenSearch (v2.0 schema).
+type LogDocument struct {
+	DocType       string `json:"doc_type"`
+	SchemaVersion string `json:"schema_version"`
+
+	// Required fields
+	Application string `json:"application"`
+	Component   string `json:"component"`
+	Timestamp   string `json:"timestamp"`
+
+	// IngestTimestamp is when devlogs sent the document (see WithIngestTimestamp)
+	IngestTimestamp *string `json:"ingest_timestamp,omitempty"`
+
+	// Top-level log fields
+	Message string  `json:"message"`
+	Level   string  `json:"level"`
+	Area    *string `json:"area"`
+
+	// Optional metadata
+	Environment *string `json:"environment,omitempty"`
+	Version     *string `json:"version,omitempty"`
+	Region      *string `json:"region,omitempty"`
+	Cluster     *string `json:"cluster,omitempty"`
+	OperationID *string `json:"operation_id"`
+
+	// OperationStack lists the nested operations from PushOperation, outermost first
+	OperationStack []string `json:"operation_stack,omitempty"`
+
+	// Custom fields (renamed from features)
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// FieldsJSON holds Fields encoded as a string instead (see WithFieldsAsJSONString)
+	FieldsJSON *string `json:"fields_json,omitempty"`
+
+	// Source and process info
+	Source    LogSource  `json:"source"`
+	Process   LogProcess `json:"process"`
+	Exception *string    `json:"exception,omitempty"`
+
+	// keepEmptyFields emits "fields": {} instead of omitting an empty map
+	keepEmptyFields bool
+
+	// topLevel holds extra top-level keys, such as promoted correlation IDs
+	topLevel map[string]string
+
+	// canonicalLevel is the devlogs level before any WithLevelAlias rename
+	canonicalLevel string
+}
+
+// documentKeys are the top-level keys of the v2.0 schema, which extra
+// top-level keys must not shadow.
+var documentKeys = map[string]bool{
+	"doc_type": true, "schema_version": true, "application": true, "component": true,
+	"timestamp": true, "ingest_timestamp": true, "message": true, "level": true,
+	"area": true, "environment": true, "version": true, "region": true,
+	"cluster": true, "operation_id": true, "operation_stack": true, "fields": true, "fields_json": true, "source": true,
+	"process": true, "exception": true,
+}
+
+// levelRank returns the rank of the document's devlogs level, so level routing
+// still works when WithLevelAlias has renamed Level.
+func (d *LogDocument) levelRank() int {
+	if d.canonicalLevel != "" {
+		return levelRank(d.canonicalLevel)
+	}
+	return levelRank(d.Level)
+}
+
+// stampIngestTime sets IngestTimestamp to the current time.
+func (d *LogDocument) stampIngestTime() {
+	ts := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	d.IngestTimestamp = &ts
+}
+
+// MarshalJSON encodes the document, keeping an empty fields object when
+// requested and appending any extra top-level keys.
+func (d *LogDocument) MarshalJSON() ([]byte, error) {
+	type plain LogDocument
+	var data []byte
+	var err error
+	if !d.keepEmptyFields || len(d.Fields) > 0 {
+		data, err = json.Marshal((*plain)(d))
+	} else {
+		data, err = json.Marshal(struct {
+			*plain
+			Fields map[string]interface{} `json:"fields"`
+		}{(*plain)(d), map[string]interface{}{}})
+	}
+	if err != nil || len(d.topLevel) == 0 {
+		return data, err
+	}
+
+	extra, err := json.Marshal(d.topLevel)
+	if err != nil {
+		return nil, err
+	}
+	// Splice {"k":"v"} into the closing brace of the document object
+	data = append(data[:len(data)-1], ',')
+	return append(data, extra[1:]...), nil
+}
+
+// FormatLogDocument converts an slog.Record to a LogDocument using v2.0 schema.
+func FormatLogDocument(ctx context.Context, r slog.Record, cfg *Config) *LogDocument {
+	return formatLogDocument(ctx, r, cfg, nil)
+}
+
+// formatLogDocument is FormatLogDocument for a handler, which may be nil; the
+// handler's defaults take part in resolving the area (see ResolveArea).
+func formatLogDocument(ctx context.Context, r slog.Record, cfg *Config, h *Handler) *LogDocument {
+	doc := newLogDocument(ctx, cfg, h, r.Time, r.Level, r.Message)
+
+	// Extract source info
+	if r.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{r.PC})
+		frame, _ := frames.Next()
+		if frame.File != "" {
+			doc.Source.Pathname = &frame.File
+		}
+		if frame.Line > 0 {
+			doc.Source.LineNo = &frame.Line
+		}
+		if frame.Function != "" {
+			doc.Source.FuncName = &frame.Function
+			// Use function name as logger if available
+			doc.Source.Logger = frame.Function
+		}
+	}
+
+	// Extract fields from record attributes (renamed from features).
+	// Records without attrs skip the map allocation entirely.
+	if r.NumAttrs() > 0 {
+		fields := make(map[string]interface{}, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			addAttr(fields, a)
+			return true
+		})
+		if len(fields) > 0 {
+			doc.Fields = fields
+		}
+	}
+
+	doc.OperationStack = GetOperationStack(ctx)
+
+	// Correlation IDs from ctx; record attrs with the same key win
+	for k, v := range GetCorrelations(ctx) {
+		if doc.Fields == nil {
+			doc.Fields = make(map[string]interface{})
+		}
+		if _, exists := doc.Fields[k]; !exists {
+			doc.Fields[k] = v
+		}
+	}
+
+	return doc
+}
+
+// ShortFuncName shortens a fully-qualified function name as reported by
+// runtime.Frame to its package and function, dropping the import path and any
+// pointer receiver: "github.com/org/repo/pkg.(*T).Method" becomes "pkg.Method".
+// Closure suffixes such as ".func1" are kept.
+func ShortFuncName(funcName string) string {
+	name := funcName
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	dot := strings.IndexByte(name, '.')
+	if dot < 0 {
+		return name
+	}
+	pkg, rest := name[:dot], name[dot+1:]
+	// Pointer receivers appear as (*T).Method
+	if strings.HasPrefix(rest, "(") {
+		if i := strings.Index(rest, ")."); i >= 0 {
+			rest = rest[i+2:]
+		}
+	}
+	return pkg + "." + rest
+}
+
+// NewLogDocument builds a v2.0 document without an slog.Record, for tools that
+// collect logs from other sources. It fills the same defaults as FormatLogDocument
+// (process info, context values, config metadata) and uses the current time.
+// fields is copied, so later changes to the document do not reach the caller's map.
+func NewLogDocument(ctx context.Context, cfg *Config, level slog.Level, message string, fields map[string]interface{}) *LogDocument {
+	doc := newLogDocument(ctx, cfg, nil, time.Now(), level, message)
+	if len(fields) > 0 {
+		doc.Fields = copyFields(fields)
+	}
+	return doc
+}
+
+// copyFields returns a copy of fields, copying nested groups as well.
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if nested, ok := v.(map[string]interface{}); ok {
+			v = copyFields(nested)
+		}
+		copied[k] = v
+	}
+	return copied
+}
+
+// newLogDocument fills the schema fields shared by every document. h may be nil.
+func newLogDocument(ctx context.Context, cfg *Config, h *Handler, t time.Time, level slog.Level, message string) *LogDocument {
+	doc := &LogDocument{
+		DocType:       "log_entry",
+		SchemaVersion: SchemaVersion,
+		Application:   cfg.Application,
+		Component:     cfg.Component,
+		Timestamp:     t.UTC().Format("2006-01-02T15:04:05.000Z"),
+		Message:       message,
+		Level:         NormalizeLevel(level),
+		Source: LogSource{
+			Logger: cfg.Component, // Use component as default logger name
+		},
+		Process: LogProcess{
+			ID:     os.Getpid(),
+			Thread: getGoroutineID(),
+		},
+	}
+
+	// Optional metadata
+	if cfg.Environment != "" {
+		doc.Environment = &cfg.Environment
+	}
+	if cfg.Version != "" {
+		doc.Version = &cfg.Version
+	}
+	if cfg.Region != "" {
+		doc.Region = &cfg.Region
+	}
+	if cfg.Cluster != "" {
+		doc.Cluster = &cfg.Cluster
+	}
+
+	// Get context values
+	if area := ResolveArea(ctx, h); area != "" {
+		doc.Area = &area
+	}
+	if opID := GetOperationID(ctx); opID != "" {
+		doc.OperationID = &opID
+	}
+
+	return doc
+}
+
+// ValidateDocument checks that the fields required by the v2.0 schema are
+// non-empty, returning a *ValidationError for the first one that is missing.
+func ValidateDocument(doc *LogDocument) error {
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"application", doc.Application},
+		{"component", doc.Component},
+		{"timestamp", doc.Timestamp},
+		{"message", doc.Message},
+		{"level", doc.Level},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			return &ValidationError{Field: field.name}
+		}
+	}
+	return nil
+}
+
+// addAttr resolves an attribute into fields following the slog.Handler rules:
+// empty attrs are skipped, groups with an empty key are inlined, empty groups
+// are omitted, and groups sharing a key are merged.
+func addAttr(fields map[string]interface{}, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		fields[a.Key] = resolveValue(a.Value)
+		return
+	}
+
+	attrs := a.Value.Group()
+	if a.Key == "" {
+		for _, ga := range attrs {
+			addAttr(fields, ga)
+		}
+		return
+	}
+
+	group, _ := fields[a.Key].(map[string]interface{})
+	if group == nil {
+		group = make(map[string]interface{}, len(attrs))
+	}
+	for _, ga := range attrs {
+		addAttr(group, ga)
+	}
+	if len(group) > 0 {
+		fields[a.Key] = group
+	}
+}
+
+// resolveValue converts slog.Value to a JSON-serializable value.
+func resolveValue(v slog.Value) interface{} {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return v.Uint64()
+	case slog.KindFloat64:
+		return v.Float64()
+	case slog.KindBool:
+		return v.Bool()
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339)
+	case slog.KindGroup:
+		attrs := v.Group()
+		m := make(map[string]interface{}, len(attrs))
+		for _, a := range attrs {
+			addAttr(m, a)
+		}
+		return m
+	case slog.KindAny:
+		value := v.Any()
+		if marshal := lookupFieldMarshaler(value); marshal != nil {
+			return marshal(value)
+		}
+		return value
+	default:
+		return v.String()
+	}
+}
+
+var (
+	// fieldMarshalers convert field values of special types before encoding
+	fieldMarshalers = map[reflect.Type]func(v interface{}) interface{}{
+		reflect.TypeOf([]byte(nil)): marshalBytes,
+		reflect.TypeOf(net.IP(nil)): func(v interface{}) interface{} { return v.(net.IP).String() },
+	}
+	fieldMarshalersMu sync.RWMutex
+)
+
+// RegisterFieldMarshaler sets the conversion applied to field values of type t
+// before they are encoded, for types whose JSON form is unhelpful in
+// OpenSearch. The value returned by marshal is encoded in their place.
+// Built-in marshalers render []byte as a string (base64 if not valid UTF-8)
+// and net.IP in its textual form; registering the same type replaces them,
+// and a nil marshal removes the entry.
+func RegisterFieldMarshaler(t reflect.Type, marshal func(v interface{}) interface{}) {
+	fieldMarshalersMu.Lock()
+	defer fieldMarshalersMu.Unlock()
+	if marshal == nil {
+		delete(fieldMarshalers, t)
+		return
+	}
+	fieldMarshalers[t] = marshal
+}
+
+// lookupFieldMarshaler returns the registered marshaler for v's type, or nil.
+func lookupFieldMarshaler(v interface{}) func(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	fieldMarshalersMu.RLock()
+	defer fieldMarshalersMu.RUnlock()
+	return fieldMarshalers[reflect.TypeOf(v)]
+}
+
+// marshalBytes renders a byte slice as text, or base64 when it is not valid UTF-8.
+func marshalBytes(v interface{}) interface{} {
+	b := v.([]byte)
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// sanitizeFieldKeys returns a copy of fields with OpenSearch-safe keys,
+// recursing into nested groups. Keys that are already safe keep their name; a
+// rewritten key that would replace another field gets a numeric suffix, e.g.
+// "a.b" becomes "a_b_2" when "a_b" is also present.
+func sanitizeFieldKeys(fields map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	var rewritten []string
+	for k, v := range fields {
+		if sanitizeFieldKey(k) == k {
+			out[k] = sanitizeFieldValue(v)
+		} else {
+			rewritten = append(rewritten, k)
+		}
+	}
+
+	// Sort so colliding keys are numbered the same way every time
+	sort.Strings(rewritten)
+	for _, k := range rewritten {
+		base := sanitizeFieldKey(k)
+		key := base
+		for n := 2; ; n++ {
+			if _, taken := out[key]; !taken {
+				break
+			}
+			key = fmt.Sprintf("%s_%d", base, n)
+		}
+		out[key] = sanitizeFieldValue(fields[k])
+	}
+	return out
+}
+
+// sanitizeFieldValue sanitizes the keys of v if it is a nested group.
+func sanitizeFieldValue(v interface{}) interface{} {
+	if nested, ok := v.(map[string]interface{}); ok {
+		return sanitizeFieldKeys(nested)
+	}
+	return v
+}
+
+// sanitizeFieldKey replaces dots, which OpenSearch treats as object paths,
+// and strips leading underscores, which are reserved for metadata fields.
+func sanitizeFieldKey(key string) string {
+	key = strings.ReplaceAll(key, ".", "_")
+	key = strings.TrimLeft(key, "_")
+	if key == "" {
+		return "field"
+	}
+	return key
+}
+
+// getGoroutineID extracts the goroutine ID from runtime.Stack.
+func getGoroutineID() int {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	// Stack output starts with "goroutine <id> [...]"
+	s := string(buf[:n])
+	if strings.HasPrefix(s, "goroutine ") {
+		s = s[len("goroutine "):]
+		if idx := strings.IndexByte(s, ' '); idx > 0 {
+			if id, err := strconv.Atoi(s[:idx]); err == nil {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// FormatException formats an error with stack trace for the exception field.
+// Errors it wraps are followed by a "Caused by:" line each, found by calling
+// errors.Unwrap repeatedly, with their own stack trace if they carry one (such
+// as errors from github.com/pkg/errors).
+func FormatException(err error) string {
+	if err == nil {
+		return ""
+	}
+	return formatWithStack(err.Error()) + formatCauses(err)
+}
+
+// FormatPanic formats a recovered panic value with stack trace for the
+// exception field. Unlike FormatException it accepts any value, since panics
+// are often strings or structs rather than errors:
+//
+//	defer func() {
+//		if v := recover(); v != nil {
+//			exception := devlogs.FormatPanic(v)
+//			...
+//		}
+//	}()
+func FormatPanic(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if err, ok := v.(error); ok {
+		return formatWithStack(err.Error()) + formatCauses(err)
+	}
+	return formatWithStack(fmt.Sprintf("panic: %v", v))
+}
+
+// formatWithStack appends a stack trace starting at the caller of
+// FormatException or FormatPanic.
+func formatWithStack(msg string) string {
+	var buf bytes.Buffer
+	buf.WriteString(msg)
+	buf.WriteString("\n\nStack trace:\n")
+
+	// Get stack trace, skipping runtime.Callers, this function and its caller
+	var stack [32]uintptr
+	n := runtime.Callers(3, stack[:])
+	writeFrames(&buf, stack[:n])
+
+	return buf.String()
+}
+
+// writeFrames writes the function and file:line of each program counter.
+func writeFrames(buf *bytes.Buffer, pcs []uintptr) {
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		buf.WriteString("  ")
+		buf.WriteString(frame.Function)
+		buf.WriteString("\n    ")
+		buf.WriteString(frame.File)
+		buf.WriteString(":")
+		buf.WriteString(strconv.Itoa(frame.Line))
+		buf.WriteString("\n")
+		if !more {
+			break
+		}
+	}
+}
+
+// formatCauses writes a "Caused by:" section for each error err wraps, depth
+// first. Errors wrapping several others, from errors.Join or fmt.Errorf with
+// more than one %w, list each in order. A cause whose message repeats its
+// parent's and that has no stack of its own, as when an error is wrapped only
+// to attach a stack, is skipped.
+func formatCauses(err error) string {
+	var buf bytes.Buffer
+	writeCauses(&buf, err, err.Error())
+	return buf.String()
+}
+
+func writeCauses(buf *bytes.Buffer, err error, prev string) {
+	var causes []error
+	switch wrapper := err.(type) {
+	case interface{ Unwrap() error }:
+		causes = []error{wrapper.Unwrap()}
+	case interface{ Unwrap() []error }:
+		causes = wrapper.Unwrap()
+	}
+	for _, cause := range causes {
+		if cause == nil {
+			continue
+		}
+		msg := cause.Error()
+		if pcs := errorStack(cause); msg != prev || len(pcs) > 0 {
+			buf.WriteString("\nCaused by: ")
+			buf.WriteString(msg)
+			buf.WriteString("\n")
+			if len(pcs) > 0 {
+				writeFrames(buf, pcs)
+			}
+		}
+		writeCauses(buf, cause, msg)
+	}
+}
+
+// errorStack returns the stack recorded by err, if it has a StackTrace method
+// returning a slice of program counters, like github.com/pkg/errors does.
+// Reflection keeps devlogs free of a dependency on any particular package.
+func errorStack(err error) []uintptr {
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return nil
+	}
+	out := method.Type().Out(0)
+	if out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	trace := method.Call(nil)[0]
+	pcs := make([]uintptr, trace.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(trace.Index(i).Uint())
+	}
+	return pcs
+}
@@ -1,135 +1,1994 @@
-package devlogs
-
-import (
-	"context"
-	"log/slog"
-)
-
-// Handler implements slog.Handler for devlogs (v2.0).
-type Handler struct {
-	client *Client
-	cfg    *Config
-	level  slog.Level
-	attrs  []slog.Attr
-	groups []string
-	cb     *CircuitBreaker
-}
-
-// HandlerOption configures a Handler.
-type HandlerOption func(*Handler)
-
-// WithLevel sets the minimum log level.
-func WithLevel(level slog.Level) HandlerOption {
-	return func(h *Handler) {
-		h.level = level
-	}
-}
-
-// WithApplication sets the application name for v2.0 schema.
-func WithApplication(name string) HandlerOption {
-	return func(h *Handler) {
-		h.cfg.Application = name
-	}
-}
-
-// WithComponent sets the component name for v2.0 schema.
-func WithComponent(name string) HandlerOption {
-	return func(h *Handler) {
-		h.cfg.Component = name
-	}
-}
-
-// WithEnvironment sets the environment for v2.0 schema.
-func WithEnvironment(env string) HandlerOption {
-	return func(h *Handler) {
-		h.cfg.Environment = env
-	}
-}
-
-// WithVersion sets the version for v2.0 schema.
-func WithVersion(version string) HandlerOption {
-	return func(h *Handler) {
-		h.cfg.Version = version
-	}
-}
-
-// WithLoggerName sets the logger name (deprecated, use WithComponent).
-func WithLoggerName(name string) HandlerOption {
-	return WithComponent(name)
-}
-
-// NewHandler creates a new devlogs slog.Handler.
-func NewHandler(cfg *Config, opts ...HandlerOption) (*Handler, error) {
-	client := NewClient(cfg)
-	return NewHandlerWithClient(client, cfg, opts...), nil
-}
-
-// NewHandlerWithClient creates a handler with a custom client.
-func NewHandlerWithClient(client *Client, cfg *Config, opts ...HandlerOption) *Handler {
-	h := &Handler{
-		client: client,
-		cfg:    cfg,
-		level:  slog.LevelDebug,
-		cb:     DefaultCircuitBreaker(),
-	}
-
-	for _, opt := range opts {
-		opt(h)
-	}
-
-	return h
-}
-
-// Enabled reports whether the handler handles records at the given level.
-func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
-	return level >= h.level
-}
-
-// Handle handles a log record.
-func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
-	// Check circuit breaker
-	if h.cb.IsOpen() {
-		return nil
-	}
-
-	// Add handler-level attrs to record
-	for _, a := range h.attrs {
-		r.AddAttrs(a)
-	}
-
-	// Format document with v2.0 schema
-	doc := FormatLogDocument(ctx, r, h.cfg)
-
-	// Fire-and-forget indexing
-	go func() {
-		err := h.client.Index(context.Background(), doc)
-		if err != nil {
-			h.cb.RecordFailure(err)
-		} else {
-			h.cb.RecordSuccess()
-		}
-	}()
-
-	return nil
-}
-
-// WithAttrs returns a new Handler with additional attributes.
-func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	newHandler := *h
-	newHandler.attrs = make([]slog.Attr, len(h.attrs)+len(attrs))
-	copy(newHandler.attrs, h.attrs)
-	copy(newHandler.attrs[len(h.attrs):], attrs)
-	return &newHandler
-}
-
-// WithGroup returns a new Handler with a group name.
-func (h *Handler) WithGroup(name string) slog.Handler {
-	if name == "" {
-		return h
-	}
-	newHandler := *h
-	newHandler.groups = make([]string, len(h.groups)+1)
-	copy(newHandler.groups, h.groups)
-	newHandler.groups[len(h.groups)] = name
-	return &newHandler
-}
+package devlogs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Handler implements slog.Handler for devlogs (v2.0).
+type Handler struct {
+	client *Client
+	cfg    *Config
+	level  slog.Level
+	attrs  []slog.Attr
+	groups []string
+	cb     *CircuitBreaker
+
+	// externalBreaker is set when cb came from WithCircuitBreaker and may be shared
+	externalBreaker bool
+
+	// defaultArea is used when the context has no area (see ResolveArea)
+	defaultArea string
+
+	// envArea is DEVLOGS_AREA, read once when the handler is built
+	envArea string
+
+	// indexResolvers pick the target index per document, first match wins
+	indexResolvers []IndexResolver
+
+	// defaultFields seeds fields for records that have none (nil disables)
+	defaultFields map[string]interface{}
+
+	// sanitizeKeys makes field keys safe for OpenSearch mappings
+	sanitizeKeys bool
+
+	// fieldRenames maps attribute keys to canonical field names at any depth
+	fieldRenames map[string]string
+
+	// fieldsAsJSON stores fields as one JSON string in fields_json
+	fieldsAsJSON bool
+
+	// hashedFields lists keys whose values are replaced by a salted SHA-256 digest
+	hashedFields map[string]bool
+	hashSalt     string
+
+	// fieldTypes coerces listed field values to stable types
+	fieldTypes map[string]FieldType
+
+	// topLevelCorrelations promotes correlation IDs from fields to top-level keys
+	topLevelCorrelations bool
+
+	// shortenFunc rewrites source.funcName and the logger derived from it (nil keeps the full name)
+	shortenFunc func(string) string
+
+	// replaceAttr rewrites or removes attrs before formatting (nil disables)
+	replaceAttr func(groups []string, a slog.Attr) slog.Attr
+
+	// typeSuffixes append a suffix for the value kind to attr keys (nil disables)
+	typeSuffixes map[slog.Kind]string
+
+	// numericDurations and epochTimes emit durations and times as int64 millis
+	numericDurations bool
+	epochTimes       bool
+
+	// levelField names an attribute whose level string overrides the record level
+	levelField string
+
+	// levelAliases rename normalized level strings (e.g. "warning" to "warn")
+	levelAliases map[string]string
+
+	// multiline splits multi-line messages (0 keeps them verbatim)
+	multiline MultilineMode
+
+	// messageTemplates adds a message_template field with variable tokens replaced
+	messageTemplates bool
+
+	// emptyMessage supplies a message for records without one (nil keeps it empty)
+	emptyMessage func(r slog.Record) string
+
+	// allowedFields restricts fields to these dotted paths (nil allows all)
+	allowedFields map[string]bool
+
+	// maxFields caps the number of top-level fields (0 disables)
+	maxFields int
+
+	// minDebugSize skips debug documents smaller than this many JSON bytes (0 disables)
+	minDebugSize int
+
+	// ipMasks anonymize IP address values in fields (nil disables)
+	ipV4Mask net.IPMask
+	ipV6Mask net.IPMask
+
+	// maxClockSkew clamps timestamps further than this in the future (0 disables)
+	maxClockSkew time.Duration
+
+	// ingestTimestamp stamps ingest_timestamp when a document is sent
+	ingestTimestamp bool
+
+	// retry re-sends documents after transient failures (nil disables)
+	retry *retryPolicy
+
+	// upsertKey derives a document _id so repeated records overwrite each other
+	upsertKey func(*LogDocument) string
+
+	// schemaVersion overrides SchemaVersion on documents when set
+	schemaVersion string
+
+	// retentionDays stamps retention_days on documents by level (nil disables)
+	retentionDays map[string]int
+
+	// goBuildFields holds go_version/module_version from WithGoBuildInfo
+	goBuildFields map[string]interface{}
+
+	// indexSuffix is appended to the configured index (see WithBuildIndexSuffix)
+	indexSuffix string
+
+	// Batching settings (batching is enabled when batching is set)
+	batching      bool
+	batchSize     int
+	batchInterval time.Duration
+	bulkByteLimit int
+	maxBatchAge   time.Duration
+	maxBulk       int
+	ordered       bool
+	flushLevel    *slog.Level
+	batcher       *batcher
+
+	// Deduplication of repeated records (enabled when dedupWindow > 0)
+	dedupWindow time.Duration
+	dedup       *deduper
+
+	// rateLimit drops records beyond a global rate (nil disables)
+	rateLimit *tokenBucket
+
+	// onDrop is called for records discarded without being sent
+	onDrop func(r slog.Record)
+
+	// leakCheck warns when the handler is garbage collected without Close
+	leakCheck bool
+	leakGuard *leakGuard
+
+	// indexBreakers replaces cb with a breaker per index (nil shares cb)
+	perIndexBreaker bool
+	indexBreakers   *breakerSet
+
+	// onReconnect is called when the circuit breaker closes again (nil disables)
+	onReconnect func()
+
+	// onBatchError receives documents rejected within a bulk request (nil ignores them)
+	onBatchError func(failed []FailedItem)
+
+	// err records an invalid option; NewHandler returns it
+	err error
+
+	// workers sends documents on a fixed goroutine pool of asyncWorkers
+	// goroutines (nil spawns one per record)
+	asyncWorkers int
+	workers      *workerPool
+
+	// overflow decides what Handle does when the worker queue is full
+	overflow OverflowPolicy
+
+	// warmup pings OpenSearch in NewHandler, failing construction if it is unreachable
+	warmup bool
+
+	// validate checks documents with ValidateDocument before sending
+	validate bool
+
+	// file receives documents instead of OpenSearch (nil disables)
+	file *ndjsonFile
+
+	// mirror also writes each record as a text line (nil disables)
+	mirror *mirror
+
+	// spanEvents also records documents as trace span events (nil disables)
+	spanEvents      SpanEventRecorder
+	spanEventsIndex bool
+
+	// dryRun receives documents as JSON instead of OpenSearch (nil disables)
+	dryRun *dryRunWriter
+
+	// prettyPrint indents dry-run output; the wire and NDJSON formats stay compact
+	prettyPrint bool
+
+	// recordModifier adjusts records before they are formatted
+	recordModifier func(ctx context.Context, r *slog.Record)
+
+	// indices creates missing indices before sending (nil disables)
+	indices *indexCache
+
+	// threadID overrides process.thread (nil uses the goroutine ID)
+	threadID func() int
+
+	// requireOperationID generates an operation_id for documents without one
+	requireOperationID bool
+	warnOperationID    bool
+
+	// fieldStats samples per-field value sizes (nil disables)
+	fieldStats *fieldSizeStats
+
+	// selfLogger receives devlogs' own diagnostics (nil means stderr)
+	selfLogger *slog.Logger
+
+	// Shutdown settings
+	shutdownTimeout time.Duration
+
+	// state is shared with handlers derived via WithAttrs and WithGroup
+	state *handlerState
+}
+
+// handlerState is runtime state shared by a handler and its derived handlers.
+type handlerState struct {
+	// pending tracks fire-and-forget sends so Flush can wait for them
+	pending     sync.WaitGroup
+	pendingDocs atomic.Int64
+
+	// dropped counts records discarded without being sent
+	dropped atomic.Int64
+
+	// opIDWarning reports a generated operation_id once (see WithRequireOperationID)
+	opIDWarning sync.Once
+
+	// ctx is canceled when Close times out, aborting in-flight requests
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// reloadMu serializes Reload calls
+	reloadMu sync.Mutex
+
+	// indexMu guards index, the default index set by SetIndex or
+	// WithBuildIndexSuffix (empty defers to the client's index), and
+	// configIndex, the Config.Index it was derived from
+	indexMu     sync.RWMutex
+	index       string
+	configIndex string
+}
+
+// DefaultShutdownTimeout bounds how long Close waits for buffered records.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// WithLevel sets the minimum log level.
+func WithLevel(level slog.Level) HandlerOption {
+	return func(h *Handler) {
+		h.level = level
+	}
+}
+
+// WithApplication sets the application name for v2.0 schema.
+func WithApplication(name string) HandlerOption {
+	return func(h *Handler) {
+		h.cfg.Application = name
+	}
+}
+
+// WithComponent sets the component name for v2.0 schema.
+func WithComponent(name string) HandlerOption {
+	return func(h *Handler) {
+		h.cfg.Component = name
+	}
+}
+
+// WithEnvironment sets the environment for v2.0 schema.
+func WithEnvironment(env string) HandlerOption {
+	return func(h *Handler) {
+		h.cfg.Environment = env
+	}
+}
+
+// WithVersion sets the version for v2.0 schema.
+func WithVersion(version string) HandlerOption {
+	return func(h *Handler) {
+		h.cfg.Version = version
+	}
+}
+
+// WithRegion sets the deployment region emitted as a top-level field.
+func WithRegion(region string) HandlerOption {
+	return func(h *Handler) {
+		h.cfg.Region = region
+	}
+}
+
+// WithCluster sets the deployment cluster emitted as a top-level field.
+func WithCluster(cluster string) HandlerOption {
+	return func(h *Handler) {
+		h.cfg.Cluster = cluster
+	}
+}
+
+// WithLoggerName sets the logger name (deprecated, use WithComponent).
+func WithLoggerName(name string) HandlerOption {
+	return WithComponent(name)
+}
+
+// WithIndexResolver adds a resolver that picks the target index per document.
+// Resolvers run in the order they were added and the first non-empty index wins;
+// if none match, the client's configured index is used.
+func WithIndexResolver(resolve IndexResolver) HandlerOption {
+	return func(h *Handler) {
+		h.indexResolvers = append(h.indexResolvers, resolve)
+	}
+}
+
+// WithErrorIndex routes records at or above atLevel to a separate index,
+// keeping error triage fast. Other records go to the configured index.
+func WithErrorIndex(index string, atLevel slog.Level) HandlerOption {
+	return WithIndexResolver(LevelIndexResolver(index, atLevel))
+}
+
+// WithDefaultFields always emits a fields object so downstream mappings stay stable.
+// Records without any fields get a copy of defaults, which may be empty to emit {}.
+func WithDefaultFields(defaults map[string]interface{}) HandlerOption {
+	return func(h *Handler) {
+		if defaults == nil {
+			defaults = map[string]interface{}{}
+		}
+		h.defaultFields = defaults
+	}
+}
+
+// WithSanitizeFieldKeys rewrites field keys so they index cleanly: dots become
+// underscores (instead of creating nested objects) and leading underscores are
+// stripped. Nested group keys are sanitized too.
+func WithSanitizeFieldKeys() HandlerOption {
+	return func(h *Handler) {
+		h.sanitizeKeys = true
+	}
+}
+
+// WithFieldRenames renames attribute keys to canonical field names before
+// indexing, e.g. WithFieldRenames(map[string]string{"userId": "user_id"}), so
+// naming can be standardized without touching call sites. Keys are matched at
+// every level, including inside groups. A renamed value replaces any field
+// already logged under the canonical name. Other options that take field names
+// (allowlist, type coercion) see the canonical names.
+func WithFieldRenames(renames map[string]string) HandlerOption {
+	return func(h *Handler) {
+		h.fieldRenames = renames
+	}
+}
+
+// WithFieldsAsJSONString serializes the custom fields into a single
+// fields_json string (mapped as a keyword) instead of the dynamic fields
+// object, so arbitrary attributes can never cause mapping explosions or
+// conflicts. Fields can then no longer be queried individually.
+func WithFieldsAsJSONString() HandlerOption {
+	return func(h *Handler) {
+		h.fieldsAsJSON = true
+	}
+}
+
+// WithHashedFields replaces the values of the listed fields with the hex
+// SHA-256 digest of salt followed by the value, so documents can still be
+// correlated on, say, a user ID without storing it in clear. Keys match at any
+// depth, or name one field by dotted path (e.g. "user.email"). The same value
+// and salt always give the same digest; keep the salt secret, since common
+// values can otherwise be recovered by hashing guesses.
+func WithHashedFields(keys []string, salt string) HandlerOption {
+	return func(h *Handler) {
+		h.hashedFields = make(map[string]bool, len(keys))
+		for _, k := range keys {
+			h.hashedFields[k] = true
+		}
+		h.hashSalt = salt
+	}
+}
+
+// WithFieldTypeCoercion converts the listed fields to fixed types before indexing,
+// preventing mapping conflicts when the same key is logged with mixed types
+// (e.g. always stringify user_id). Keys may be dotted paths into groups.
+// Values that cannot be converted are dropped; unlisted fields pass through.
+func WithFieldTypeCoercion(types map[string]FieldType) HandlerOption {
+	return func(h *Handler) {
+		h.fieldTypes = types
+	}
+}
+
+// WithTopLevelCorrelations writes correlation IDs set with WithCorrelation as
+// top-level document keys (e.g. "trace_id") instead of fields. Keys that clash
+// with a schema field, or with a record attr of the same name, stay in fields.
+func WithTopLevelCorrelations() HandlerOption {
+	return func(h *Handler) {
+		h.topLevelCorrelations = true
+	}
+}
+
+// WithSourceFunctionShortening rewrites source.funcName, and the logger name
+// derived from it, with shorten. A nil shorten uses ShortFuncName, turning
+// "github.com/org/repo/pkg.(*T).Method" into "pkg.Method". Without this
+// option the fully-qualified name is kept.
+func WithSourceFunctionShortening(shorten func(funcName string) string) HandlerOption {
+	return func(h *Handler) {
+		if shorten == nil {
+			shorten = ShortFuncName
+		}
+		h.shortenFunc = shorten
+	}
+}
+
+// WithReplaceAttr rewrites each record attribute before it is formatted, like
+// slog.HandlerOptions.ReplaceAttr: replace receives the keys of the groups
+// enclosing the attribute (nil at the top level) and returns the attribute to
+// keep, e.g. with a new key or a redacted value, or the zero Attr to drop it.
+// It is not called for groups themselves, which are dropped if left empty, nor
+// for document fields such as message and level.
+func WithReplaceAttr(replace func(groups []string, a slog.Attr) slog.Attr) HandlerOption {
+	return func(h *Handler) {
+		h.replaceAttr = replace
+	}
+}
+
+// DefaultTypeSuffixes is the kind to key suffix mapping WithFieldTypeSuffix
+// uses when given nil.
+var DefaultTypeSuffixes = map[slog.Kind]string{
+	slog.KindInt64:   "_i",
+	slog.KindUint64:  "_i",
+	slog.KindFloat64: "_f",
+	slog.KindString:  "_s",
+	slog.KindBool:    "_b",
+}
+
+// WithFieldTypeSuffix appends a suffix for the value's kind to each field key,
+// e.g. "count" becomes "count_i" and "name" becomes "name_s", so dynamic
+// mapping can never see one field with two types. It is an alternative to
+// WithFieldTypeCoercion where no index template is available. suffixes maps
+// kinds to suffixes; nil uses DefaultTypeSuffixes. Kinds not listed (such as
+// slog.KindAny), group keys and keys that already end with their suffix are
+// left unchanged.
+//
+// Suffixes are added after renames, hashing, the allowlist and type coercion,
+// so those options name the original keys, and the suffix reflects the value
+// as written: durations and times are strings unless WithNumericDurations or
+// WithEpochTimes makes them integers. When a suffixed key is already taken,
+// a number goes before the suffix (e.g. "count_2_i") so both values are kept.
+func WithFieldTypeSuffix(suffixes map[slog.Kind]string) HandlerOption {
+	return func(h *Handler) {
+		if suffixes == nil {
+			suffixes = DefaultTypeSuffixes
+		}
+		h.typeSuffixes = suffixes
+	}
+}
+
+// WithNumericDurations emits time.Duration field values as int64 milliseconds
+// instead of strings like "1.5s", so they can be aggregated in OpenSearch.
+func WithNumericDurations() HandlerOption {
+	return func(h *Handler) {
+		h.numericDurations = true
+	}
+}
+
+// WithEpochTimes emits time.Time field values as int64 epoch milliseconds
+// instead of RFC3339 strings, so they can be aggregated in OpenSearch.
+func WithEpochTimes() HandlerOption {
+	return func(h *Handler) {
+		h.epochTimes = true
+	}
+}
+
+// WithTimestampSkewCorrection clamps the timestamp of records dated more than
+// maxSkew in the future to the handler's current time, so a drifting app clock
+// cannot put logs ahead of time-range queries. Corrected documents carry a
+// _clock_skew_ms field with how far ahead the original timestamp was.
+func WithTimestampSkewCorrection(maxSkew time.Duration) HandlerOption {
+	return func(h *Handler) {
+		if maxSkew <= 0 {
+			h.err = fmt.Errorf("invalid max clock skew %v: must be positive", maxSkew)
+			return
+		}
+		h.maxClockSkew = maxSkew
+	}
+}
+
+// WithLevelFromField takes the document level from the record attribute key
+// when it holds a known level string ("debug", "info", "warning"/"warn",
+// "error" or "critical", in any case), for wrapper logs whose payload carries
+// its own level. The attribute is removed from fields. Records without it, or
+// with an unknown level, keep their slog level and the attribute.
+func WithLevelFromField(key string) HandlerOption {
+	return func(h *Handler) {
+		h.levelField = key
+	}
+}
+
+// WithLevelAlias renames level strings before they are written, for parity
+// with other services sharing the dashboards, e.g.
+// WithLevelAlias(map[string]string{"warning": "warn"}). Keys are the devlogs
+// names: debug, info, warning and error. Unmapped levels are unchanged.
+func WithLevelAlias(aliases map[string]string) HandlerOption {
+	return func(h *Handler) {
+		h.levelAliases = aliases
+	}
+}
+
+// MultilineMode selects where WithMultilineMessages moves the lines after the first.
+type MultilineMode int
+
+const (
+	// MultilineDetail moves the remaining lines to a message_detail field.
+	MultilineDetail MultilineMode = iota + 1
+	// MultilineException moves the remaining lines to the exception field,
+	// falling back to message_detail if the record already has an exception.
+	MultilineException
+)
+
+// WithMultilineMessages keeps only the first line of a multi-line message in
+// message, so table views stay one row per line, and moves the rest (such as
+// an embedded stack trace) according to mode.
+func WithMultilineMessages(mode MultilineMode) HandlerOption {
+	return func(h *Handler) {
+		h.multiline = mode
+	}
+}
+
+// WithMessageTemplateExtraction adds a message_template field holding the
+// message with numbers and UUIDs replaced by "{}", so "user 42 did X" and
+// "user 7 did X" group together as "user {} did X". The rendered message is
+// kept as is. Messages without such tokens get no message_template field.
+func WithMessageTemplateExtraction() HandlerOption {
+	return func(h *Handler) {
+		h.messageTemplates = true
+	}
+}
+
+// WithEmptyMessagePlaceholder sets the message of records logged with an empty
+// message, which dashboards otherwise show as blank rows.
+func WithEmptyMessagePlaceholder(placeholder string) HandlerOption {
+	return func(h *Handler) {
+		h.emptyMessage = func(slog.Record) string { return placeholder }
+	}
+}
+
+// WithEmptyMessageFromFirstField uses the key of the first attribute as the
+// message of records logged with an empty message.
+func WithEmptyMessageFromFirstField() HandlerOption {
+	return func(h *Handler) {
+		h.emptyMessage = func(r slog.Record) string {
+			if keys := attrKeyOrder(r); len(keys) > 0 {
+				return keys[0]
+			}
+			return ""
+		}
+	}
+}
+
+// WithFieldAllowlist indexes only the listed fields and drops all others, for
+// privacy and a stable mapping. Keys are dotted paths into groups: "http" keeps
+// the whole http group while "http.status" keeps only that field. Fields added
+// by WithGoBuildInfo and WithDefaultFields are not filtered.
+func WithFieldAllowlist(keys []string) HandlerOption {
+	return func(h *Handler) {
+		h.allowedFields = make(map[string]bool, len(keys))
+		for _, k := range keys {
+			h.allowedFields[k] = true
+		}
+	}
+}
+
+// WithMaxFieldCount caps records at n top-level fields to protect the index
+// mapping from records with many dynamic keys. The first n fields, in the order
+// they were added, are kept; the rest are serialized into an "_overflow" JSON
+// string and "_fields_truncated" is set to true.
+func WithMaxFieldCount(n int) HandlerOption {
+	return func(h *Handler) {
+		h.maxFields = n
+	}
+}
+
+// WithDropBelowSize skips debug records whose formatted document is smaller
+// than n bytes of JSON, a crude volume control for chatty debug logs with
+// trivial messages and no fields. Records at info level and above are always
+// indexed. Skipped records are not counted as dropped, like sampled ones.
+func WithDropBelowSize(n int) HandlerOption {
+	return func(h *Handler) {
+		if n < 1 {
+			h.err = fmt.Errorf("invalid minimum document size %d", n)
+			return
+		}
+		h.minDebugSize = n
+	}
+}
+
+// WithObfuscateIP anonymizes field values that are IP addresses by keeping only
+// the leading prefix bits, e.g. WithObfuscateIP(24, 112) turns 192.168.1.42 into
+// 192.168.1.0 and zeroes the last segment of an IPv6 address. Nested groups are
+// included; non-IP values are left untouched.
+func WithObfuscateIP(v4PrefixLen, v6PrefixLen int) HandlerOption {
+	return func(h *Handler) {
+		v4Mask := net.CIDRMask(v4PrefixLen, 32)
+		v6Mask := net.CIDRMask(v6PrefixLen, 128)
+		if v4Mask == nil || v6Mask == nil {
+			h.err = fmt.Errorf("invalid IP prefix lengths /%d and /%d", v4PrefixLen, v6PrefixLen)
+			return
+		}
+		h.ipV4Mask = v4Mask
+		h.ipV6Mask = v6Mask
+	}
+}
+
+// WithIngestTimestamp adds an ingest_timestamp field holding when devlogs sent
+// the document, alongside the event timestamp, to reveal pipeline lag. With
+// batching, it is the time the bulk request is sent rather than when buffered.
+func WithIngestTimestamp() HandlerOption {
+	return func(h *Handler) {
+		h.ingestTimestamp = true
+	}
+}
+
+// WithUpsertKey derives a deterministic _id for each document, so documents with
+// the same key overwrite each other instead of being duplicated. Useful for
+// idempotent event logging from pipelines that may retry. An empty key indexes
+// the document without an ID.
+func WithUpsertKey(key func(*LogDocument) string) HandlerOption {
+	return func(h *Handler) {
+		h.upsertKey = key
+	}
+}
+
+// WithRetry re-sends documents that failed with a transient connection error
+// (including timeouts, 429 and 5xx responses) up to maxAttempts times in total,
+// waiting backoff before the first retry and doubling it each time. Auth and
+// query errors are not retried.
+//
+// A timed-out request may still have succeeded on the server, so with retries
+// enabled documents without an _id get a random one before the first attempt,
+// and every retry reuses it to overwrite rather than duplicate. Disable that
+// with WithIdempotentRetries(false).
+func WithRetry(maxAttempts int, backoff time.Duration) HandlerOption {
+	return func(h *Handler) {
+		if maxAttempts < 1 || backoff < 0 {
+			h.err = fmt.Errorf("invalid retry policy: %d attempts, %v backoff", maxAttempts, backoff)
+			return
+		}
+		idempotent := true
+		if h.retry != nil {
+			idempotent = h.retry.idempotent
+		}
+		h.retry = &retryPolicy{attempts: maxAttempts, backoff: backoff, idempotent: idempotent}
+	}
+}
+
+// WithIdempotentRetries sets whether WithRetry assigns each document an _id so
+// retries cannot duplicate it. It is on by default.
+func WithIdempotentRetries(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		if h.retry == nil {
+			h.retry = &retryPolicy{attempts: 1}
+		}
+		h.retry.idempotent = enabled
+	}
+}
+
+// WithSchemaVersion overrides the schema_version stamped on documents,
+// for consumers migrating between document layouts.
+func WithSchemaVersion(version string) HandlerOption {
+	return func(h *Handler) {
+		h.schemaVersion = version
+	}
+}
+
+// readBuildInfo is debug.ReadBuildInfo, replaceable in tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// DefaultRetentionDays is the level to retention mapping WithRetentionHints
+// uses when given nil.
+var DefaultRetentionDays = map[string]int{
+	"debug":   3,
+	"info":    30,
+	"warning": 30,
+	"error":   90,
+}
+
+// WithRetentionHints stamps a retention_days field on each document from its
+// level, so an ISM policy can expire short-lived records, such as debug logs,
+// sooner than the index default. days maps normalized levels ("debug", "info",
+// "warning", "error") to days; nil uses DefaultRetentionDays. Documents whose
+// level is not listed get no hint. Lookups use the level before WithLevelAlias
+// renames it.
+func WithRetentionHints(days map[string]int) HandlerOption {
+	return func(h *Handler) {
+		if days == nil {
+			days = DefaultRetentionDays
+		}
+		h.retentionDays = make(map[string]int, len(days))
+		for level, d := range days {
+			if level == "warn" {
+				level = "warning"
+			}
+			h.retentionDays[level] = d
+		}
+	}
+}
+
+// WithGoBuildInfo adds go_version and module_version fields to every document.
+// Build info is read once from the binary; if it is unavailable, go_version falls
+// back to the running toolchain version and module_version is omitted.
+func WithGoBuildInfo() HandlerOption {
+	return func(h *Handler) {
+		fields := map[string]interface{}{
+			"go_version": runtime.Version(),
+		}
+		if info, ok := readBuildInfo(); ok {
+			if info.GoVersion != "" {
+				fields["go_version"] = info.GoVersion
+			}
+			if info.Main.Version != "" {
+				fields["module_version"] = info.Main.Version
+			}
+		}
+		h.goBuildFields = fields
+	}
+}
+
+// WithBuildIndexSuffix appends the resolved build_id (see ResolveBuildInfo) to
+// the configured index, e.g. devlogs-0001-main-20260124t153045z, so each
+// deployment writes to its own index. The build_id is lowercased and stripped
+// of characters OpenSearch does not allow in index names. Only this handler
+// uses the suffixed index; the Config and Client it was built from are unchanged.
+// NewHandler fails if no build_id was provided by the environment or a build
+// info file: a generated one changes on every start and would create a new
+// index each time.
+func WithBuildIndexSuffix() HandlerOption {
+	return func(h *Handler) {
+		info := ResolveBuildInfo(nil)
+		if info.Source == SourceGenerated {
+			h.err = fmt.Errorf("build index suffix requires a build_id from the environment or a build info file, got generated %q", info.BuildID)
+			return
+		}
+		if suffix := sanitizeIndexName(info.BuildID); suffix != "" {
+			h.indexSuffix = "-" + suffix
+		}
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker used to pause indexing on failures.
+// Passing the same breaker to several handlers makes them pause together. The
+// breaker keeps its own logger (see CircuitBreaker.SetLogger); WithSelfLogging
+// does not change it.
+func WithCircuitBreaker(cb *CircuitBreaker) HandlerOption {
+	return func(h *Handler) {
+		h.cb = cb
+		h.externalBreaker = true
+	}
+}
+
+// WithPerIndexCircuitBreaker gives each target index its own circuit breaker,
+// built like the default one, so an index that fails (e.g. deleted or closed
+// and answering 404) pauses only the records routed to it while other indices
+// keep indexing. It replaces the breaker from WithCircuitBreaker. A bulk request
+// that fails as a whole counts against every index in it; documents rejected
+// individually within a bulk request do not open a breaker. See OpenIndices.
+func WithPerIndexCircuitBreaker() HandlerOption {
+	return func(h *Handler) {
+		h.perIndexBreaker = true
+	}
+}
+
+// WithAsyncWorkers sends records on n long-lived goroutines instead of one
+// goroutine per record, bounding goroutine growth under bursts. Records queue
+// up to 64 per worker; beyond that Handle blocks until a worker is free.
+// Close drains the queue before stopping the workers. Ignored with WithBatching,
+// which sends from its own goroutine; no workers are started then.
+func WithAsyncWorkers(n int) HandlerOption {
+	return func(h *Handler) {
+		if n < 1 {
+			h.err = fmt.Errorf("invalid async worker count %d", n)
+			return
+		}
+		h.asyncWorkers = n
+	}
+}
+
+// OverflowPolicy selects what Handle does when the WithAsyncWorkers queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until a worker is free. This is the default.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject drops the record and returns ErrQueueFull.
+	OverflowReject
+)
+
+// WithOverflowPolicy sets what Handle does when the WithAsyncWorkers queue is
+// full. With OverflowReject the record is dropped and Handle returns
+// ErrQueueFull, so wrappers can observe backpressure. Most slog callers ignore
+// Handle's error (slog.Logger discards it), so pair this with WithOnDrop to
+// react to rejected records.
+func WithOverflowPolicy(policy OverflowPolicy) HandlerOption {
+	return func(h *Handler) {
+		h.overflow = policy
+	}
+}
+
+// WithWarmup makes NewHandler ping OpenSearch (see Client.Ping) before
+// returning, so a bad URL or credentials fail at startup instead of on the
+// first record, and the first record does not pay for connection and TLS
+// setup; the connection stays in the HTTP client's idle pool. If the ping
+// fails, NewHandler returns its error, e.g. a *ConnectionError or *AuthError.
+func WithWarmup() HandlerOption {
+	return func(h *Handler) {
+		h.warmup = true
+	}
+}
+
+// WithValidate checks each document with ValidateDocument before it is sent.
+// Invalid documents are not sent: Handle returns the *ValidationError and it is
+// reported through the diagnostics logger (see WithSelfLogging), instead of
+// OpenSearch rejecting the document later.
+func WithValidate() HandlerOption {
+	return func(h *Handler) {
+		h.validate = true
+	}
+}
+
+// WithNDJSONFile writes documents to a local file, one JSON document per line,
+// instead of sending them to OpenSearch. Use it when an external shipper such
+// as Filebeat or Fluent Bit tails the file. The file is rotated when it would
+// exceed maxBytes (0 disables rotation), keeping up to maxBackups old files
+// named path.1, path.2 and so on. With a maxBackups of 0 no history is kept:
+// the file is truncated in place when it fills up.
+func WithNDJSONFile(path string, maxBytes int64, maxBackups int) HandlerOption {
+	return func(h *Handler) {
+		file, err := openNDJSONFile(path, maxBytes, maxBackups)
+		if err != nil {
+			h.err = err
+			return
+		}
+		h.file = file
+	}
+}
+
+// WithSpanEvents records each log as an event on the trace span in the
+// record's context, named after the message and carrying the level and fields
+// as attributes. With alsoIndex the document is indexed as well; without it,
+// records logged inside a recording span only become span events. Records
+// without a span are indexed either way. See SpanEventRecorder for an
+// OpenTelemetry implementation.
+func WithSpanEvents(recorder SpanEventRecorder, alsoIndex bool) HandlerOption {
+	return func(h *Handler) {
+		h.spanEvents = recorder
+		h.spanEventsIndex = alsoIndex
+	}
+}
+
+// WithDryRun writes each document to w as JSON instead of sending it to
+// OpenSearch, to check formatting options without a cluster. Documents are
+// one per line unless WithPrettyPrint is set.
+func WithDryRun(w io.Writer) HandlerOption {
+	return func(h *Handler) {
+		h.dryRun = &dryRunWriter{w: w}
+	}
+}
+
+// WithPrettyPrint indents the JSON written by WithDryRun for reading. It never
+// affects what is sent to OpenSearch or written by WithNDJSONFile, which must
+// stay one document per line.
+func WithPrettyPrint(pretty bool) HandlerOption {
+	return func(h *Handler) {
+		h.prettyPrint = pretty
+	}
+}
+
+// WithSharedCircuitBreaker makes the handler use the process-wide breaker from
+// DefaultCircuitBreaker, so a failure in any sharing handler pauses them all.
+// This was the default before handlers got their own breakers; use it for
+// handlers that write to the same cluster.
+func WithSharedCircuitBreaker() HandlerOption {
+	return WithCircuitBreaker(DefaultCircuitBreaker())
+}
+
+// WithStdoutMirror also writes each record to stdout as a readable text line,
+// for local development. See WithMirror.
+func WithStdoutMirror() HandlerOption {
+	return WithMirror(os.Stdout)
+}
+
+// WithMirror also writes each record to w as a line of the form
+// "timestamp LEVEL message key=value ...". Mirroring is independent of
+// indexing, so records still appear while the circuit breaker is open.
+func WithMirror(w io.Writer) HandlerOption {
+	return func(h *Handler) {
+		h.mirror = &mirror{w: w}
+	}
+}
+
+// WithRecordModifier calls fn on each record before it is formatted, e.g. to
+// derive a category attribute from the message. The record already holds the
+// handler's attrs; attrs fn adds become top-level fields outside any groups.
+func WithRecordModifier(fn func(ctx context.Context, r *slog.Record)) HandlerOption {
+	return func(h *Handler) {
+		h.recordModifier = fn
+	}
+}
+
+// WithEnsureIndex creates the target index before sending when it does not
+// exist yet. Existence is cached per index for ttl, so the check runs at most
+// once per window; an index-not-found response clears the cache so a deleted
+// index is re-created.
+func WithEnsureIndex(ttl time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.indices = newIndexCache(h.client, ttl)
+	}
+}
+
+// WithThreadIDFunc sets how process.thread is filled. The default is the
+// current goroutine ID; supply your own for an OS thread ID or a worker number.
+// fn is called on the logging goroutine for every record.
+func WithThreadIDFunc(fn func() int) HandlerOption {
+	return func(h *Handler) {
+		h.threadID = fn
+	}
+}
+
+// WithRequireOperationID guarantees every document has an operation_id. When
+// neither the context nor an "operation_id" record attribute provides one, a new
+// ID is generated for that document only. With warn set, the first generated ID
+// is reported through the diagnostics logger (see WithSelfLogging).
+func WithRequireOperationID(warn bool) HandlerOption {
+	return func(h *Handler) {
+		h.requireOperationID = true
+		h.warnOperationID = warn
+	}
+}
+
+// WithFieldSizeStats samples one in every sampleEvery records and aggregates
+// the encoded size of each field, keyed by dotted path. Read the results with
+// FieldSizeStats to find fields bloating the index.
+func WithFieldSizeStats(sampleEvery int) HandlerOption {
+	return func(h *Handler) {
+		h.fieldStats = newFieldSizeStats(sampleEvery)
+	}
+}
+
+// FieldSizeStats returns the aggregated field sizes collected since the handler
+// was created, or nil if WithFieldSizeStats is not enabled.
+func (h *Handler) FieldSizeStats() map[string]FieldSizeStat {
+	if h.fieldStats == nil {
+		return nil
+	}
+	return h.fieldStats.snapshot()
+}
+
+// WithSelfLogging routes devlogs' own diagnostics, such as circuit breaker
+// state changes, to logger instead of stderr. Breakers from WithCircuitBreaker
+// are shared and keep their own logger. The logger may itself be backed
+// by a devlogs handler; devlogs handlers ignore these diagnostics to avoid
+// feeding indexing failures back into themselves.
+func WithSelfLogging(logger *slog.Logger) HandlerOption {
+	return func(h *Handler) {
+		h.selfLogger = logger
+	}
+}
+
+// WithClientOptions applies client options to the handler's client.
+// Option errors are returned from NewHandler.
+func WithClientOptions(opts ...ClientOption) HandlerOption {
+	return func(h *Handler) {
+		for _, opt := range opts {
+			if err := opt(h.client); err != nil && h.err == nil {
+				h.err = err
+			}
+		}
+	}
+}
+
+// WithOnDrop registers a callback for every record dropped without being sent,
+// such as while the circuit breaker is open. The record is passed unformatted,
+// so the callback is cheap enough to count, sample or write to a local fallback.
+func WithOnDrop(fn func(r slog.Record)) HandlerOption {
+	return func(h *Handler) {
+		h.onDrop = fn
+	}
+}
+
+// WithLeakCheck prints a warning to stderr if the handler is garbage collected
+// without Close while it runs background goroutines (an interval flusher from
+// WithBatching or WithAsyncWorkers), which would otherwise leak silently. It
+// relies on a finalizer, so it is best-effort and meant for development.
+func WithLeakCheck() HandlerOption {
+	return func(h *Handler) {
+		h.leakCheck = true
+	}
+}
+
+// WithReconnectHook registers a callback fired once each time the circuit
+// breaker closes after being open, i.e. the first successful send after an
+// outage. Use it to replay a local fallback file or emit a metric. The hook runs
+// on its own goroutine so it never delays logging.
+func WithReconnectHook(fn func()) HandlerOption {
+	return func(h *Handler) {
+		h.onReconnect = fn
+	}
+}
+
+// WithBatchErrorHandler registers a callback for documents OpenSearch rejected
+// within a partially failed bulk request, with each item's status and reason,
+// so the application can retry, drop or dead-letter them. It is called from the
+// sender goroutine. Rejected documents are left to fn: they neither trip the
+// circuit breaker nor get self-logged. Without WithBatching it receives
+// documents whose index response failed validation (see WithResponseValidation).
+func WithBatchErrorHandler(fn func(failed []FailedItem)) HandlerOption {
+	return func(h *Handler) {
+		h.onBatchError = fn
+	}
+}
+
+// WithBatching buffers records and sends them with the _bulk API.
+// A batch is sent when it holds maxSize records or every flushInterval.
+// It is shorthand for WithFlushOnCount and WithFlushOnInterval, and only sets
+// the triggers no earlier option set, so it never undoes them whatever the
+// option order. A maxSize of 0 sets no count trigger and does not enable
+// batching by itself, but leaves it on if another flush option enabled it.
+func WithBatching(maxSize int, flushInterval time.Duration) HandlerOption {
+	return func(h *Handler) {
+		if maxSize > 0 {
+			h.batching = true
+		}
+		if h.batchSize == 0 {
+			h.batchSize = maxSize
+		}
+		if h.batchInterval == 0 {
+			h.batchInterval = flushInterval
+		}
+	}
+}
+
+// WithFlushOnCount enables batching and sends a batch once it holds n records.
+// Combine it with WithFlushOnBytes and WithFlushOnInterval as needed; triggers
+// that are not set never fire. Handler.LastFlushReason reports which one sent
+// the most recent batch.
+func WithFlushOnCount(n int) HandlerOption {
+	return func(h *Handler) {
+		if n < 1 {
+			h.err = fmt.Errorf("invalid flush count %d", n)
+			return
+		}
+		h.batching = true
+		h.batchSize = n
+	}
+}
+
+// WithFlushOnBytes enables batching and sends a batch before the next record
+// would push its encoded size past n bytes. See WithFlushOnCount.
+func WithFlushOnBytes(n int) HandlerOption {
+	return func(h *Handler) {
+		if n < 1 {
+			h.err = fmt.Errorf("invalid flush size %d", n)
+			return
+		}
+		h.batching = true
+		h.bulkByteLimit = n
+	}
+}
+
+// WithFlushOnInterval enables batching and sends the pending batch every d.
+// See WithFlushOnCount.
+func WithFlushOnInterval(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		if d <= 0 {
+			h.err = fmt.Errorf("invalid flush interval %v", d)
+			return
+		}
+		h.batching = true
+		h.batchInterval = d
+	}
+}
+
+// WithBulkByteLimit caps the encoded size of a single bulk request.
+// A batch is sent early when the next record would exceed maxBytes, which keeps
+// requests under OpenSearch's http.max_content_length. Only applies with WithBatching.
+func WithBulkByteLimit(maxBytes int) HandlerOption {
+	return func(h *Handler) {
+		h.bulkByteLimit = maxBytes
+	}
+}
+
+// WithMaxBatchAge guarantees no record stays buffered longer than d, however
+// empty the batch. Unlike the flush interval, the clock starts when the first
+// record enters an empty batch. Only applies with WithBatching.
+func WithMaxBatchAge(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.maxBatchAge = d
+	}
+}
+
+// WithMaxConcurrentBulk limits how many bulk requests may be in flight at once.
+// Further flushes wait for a free slot, smoothing load on the cluster during
+// bursts. Only applies with WithBatching.
+func WithMaxConcurrentBulk(n int) HandlerOption {
+	return func(h *Handler) {
+		h.maxBulk = n
+	}
+}
+
+// WithBulkOrdering sends batches one at a time, in the order they were
+// flushed, so a record never reaches OpenSearch before one logged earlier from
+// the same goroutine, even when the earlier batch is retried (see WithRetry).
+// Records logged concurrently from different goroutines have no order to
+// preserve and may still interleave within and across batches. Serializing
+// bulk requests lowers throughput and makes WithMaxConcurrentBulk moot. Only
+// applies with WithBatching.
+func WithBulkOrdering() HandlerOption {
+	return func(h *Handler) {
+		h.ordered = true
+	}
+}
+
+// WithFlushOnLevel makes a record at or above level flush the batch synchronously,
+// so it and all previously buffered records are written before Handle returns.
+// Only applies with WithBatching.
+func WithFlushOnLevel(level slog.Level) HandlerOption {
+	return func(h *Handler) {
+		h.flushLevel = &level
+	}
+}
+
+// WithMaxRecordRate drops records beyond perSecond on average, allowing bursts
+// of up to burst records, to contain a runaway logging loop. The limit is
+// shared by the handler and the handlers derived from it and applies to every
+// level, unlike the per-level sampling in Config.SampleRates. Throttled records
+// are counted as dropped and passed to WithOnDrop.
+func WithMaxRecordRate(perSecond float64, burst int) HandlerOption {
+	return func(h *Handler) {
+		if perSecond <= 0 || burst < 1 {
+			h.err = fmt.Errorf("invalid record rate %v with burst %d", perSecond, burst)
+			return
+		}
+		h.rateLimit = newTokenBucket(perSecond, burst)
+	}
+}
+
+// WithDedup suppresses identical records (same message, level and area) logged
+// within window. The first record is sent right away; if it repeated, one more
+// document is sent when the window ends, carrying a dedup_count field with the
+// total number of occurrences in the window. At most 1000 distinct records are tracked; the
+// least recently seen window is closed early when the limit is reached.
+func WithDedup(window time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.dedupWindow = window
+	}
+}
+
+// WithDefaultArea sets the area used when the context carries none.
+// It takes precedence over the global area; see ResolveArea.
+func WithDefaultArea(area string) HandlerOption {
+	return func(h *Handler) {
+		h.defaultArea = area
+	}
+}
+
+// WithShutdownTimeout bounds how long Close waits for buffered and in-flight
+// records, so a hung cluster cannot delay process exit past its grace period.
+// Zero waits indefinitely. The default is DefaultShutdownTimeout.
+func WithShutdownTimeout(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.shutdownTimeout = d
+	}
+}
+
+// NewHandler creates a new devlogs slog.Handler.
+func NewHandler(cfg *Config, opts ...HandlerOption) (*Handler, error) {
+	client := NewClient(cfg)
+	h := NewHandlerWithClient(client, cfg, opts...)
+	if h.err != nil {
+		// Release what the options before the failing one opened
+		h.Close()
+		return nil, h.err
+	}
+	// The client is the handler's own, so it shares the diagnostics logger
+	client.logger = h.selfLogger
+	if h.warmup {
+		if err := client.Ping(h.state.ctx); err != nil {
+			// Stop the background goroutines the options may have started
+			h.Close()
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// NewHandlerWithClient creates a handler with a custom client.
+// Each handler gets its own circuit breaker built from cfg, so handlers writing
+// to different clusters fail independently; use WithCircuitBreaker to share one.
+func NewHandlerWithClient(client *Client, cfg *Config, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		client:          client,
+		cfg:             cfg,
+		level:           slog.LevelDebug,
+		cb:              NewCircuitBreakerFromConfig(cfg),
+		shutdownTimeout: DefaultShutdownTimeout,
+		envArea:         os.Getenv("DEVLOGS_AREA"),
+		state:           &handlerState{},
+	}
+	h.state.ctx, h.state.cancel = context.WithCancel(context.Background())
+
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.state.configIndex = cfg.Index
+	if h.indexSuffix != "" {
+		h.state.index = cfg.Index + h.indexSuffix
+	}
+
+	// A breaker passed in may be shared, so only the handler's own is changed
+	if h.selfLogger != nil && !h.externalBreaker {
+		h.cb.SetLogger(h.selfLogger)
+	}
+	if h.perIndexBreaker {
+		selfLogger := h.selfLogger
+		h.indexBreakers = newBreakerSet(func() *CircuitBreaker {
+			cb := NewCircuitBreakerFromConfig(cfg)
+			if selfLogger != nil {
+				cb.SetLogger(selfLogger)
+			}
+			return cb
+		})
+	}
+	if h.asyncWorkers > 0 && !h.batching && h.err == nil {
+		h.workers = newWorkerPool(h.asyncWorkers, h.asyncWorkers*64)
+	}
+	if h.batching && h.err == nil {
+		// Capture the breakers rather than h, so the batcher's goroutines do not
+		// keep an abandoned handler reachable (see WithLeakCheck)
+		cb, breakers, onReconnect := h.cb, h.indexBreakers, h.onReconnect
+		h.batcher = newBatcher(client, h.batchSize, h.bulkByteLimit, h.batchInterval, func(indices []string, err error) {
+			if breakers == nil {
+				recordResult(cb, onReconnect, err)
+				return
+			}
+			for _, index := range indices {
+				if index == "" {
+					index = client.IndexName()
+				}
+				recordResult(breakers.get(index), onReconnect, err)
+			}
+		})
+		h.batcher.stampIngest = h.ingestTimestamp
+		h.batcher.maxAge = h.maxBatchAge
+		h.batcher.indices = h.indices
+		h.batcher.onFailedItems = h.onBatchError
+		if h.onBatchError == nil {
+			selfLogger := h.selfLogger
+			h.batcher.onFailedItems = func(failed []FailedItem) {
+				selfLog(selfLogger, slog.LevelWarn, fmt.Sprintf("Bulk request rejected %d documents: %s", len(failed), failed[0].Reason))
+			}
+		}
+		h.batcher.retry = h.retry
+		if h.maxBulk > 0 {
+			h.batcher.sem = make(chan struct{}, h.maxBulk)
+		}
+		h.batcher.ordered = h.ordered
+		h.batcher.ctx = h.state.ctx
+	}
+	if h.dedupWindow > 0 {
+		h.dedup = newDeduper(h.dedupWindow, h.emit)
+	}
+	if h.leakCheck && (h.workers != nil || (h.batcher != nil && h.batchInterval > 0)) {
+		h.leakGuard = newLeakGuard()
+	}
+
+	return h
+}
+
+// Enabled reports whether the handler handles records at the given level.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && !isSelfLog(ctx)
+}
+
+// Handle handles a log record.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	// Never index devlogs' own diagnostics (see WithSelfLogging)
+	if isSelfLog(ctx) {
+		return nil
+	}
+
+	if !h.sampled(r.Level) {
+		return nil
+	}
+
+	if h.rateLimit != nil && !h.rateLimit.allow() {
+		h.drop(r)
+		return nil
+	}
+
+	// Check circuit breaker; records are still formatted for the mirror and span
+	// events. Per-index breakers are checked once the index is resolved.
+	open := h.indexBreakers == nil && h.cb.IsOpen()
+	if open && h.mirror == nil && h.spanEvents == nil {
+		h.drop(r)
+		return nil
+	}
+	orig := r
+
+	r = h.withHandlerAttrs(r)
+	if h.recordModifier != nil {
+		// Clone so added attrs cannot leak into the caller's copy of the record
+		r = r.Clone()
+		h.recordModifier(ctx, &r)
+	}
+
+	doc := h.format(ctx, r)
+
+	if h.mirror != nil {
+		h.mirror.write(doc)
+	}
+	if h.spanEvents != nil && h.spanEvents.AddEvent(ctx, doc.Message, spanEventAttrs(doc)) && !h.spanEventsIndex {
+		return nil
+	}
+	if open {
+		h.drop(orig)
+		return nil
+	}
+
+	if h.validate {
+		if err := ValidateDocument(doc); err != nil {
+			selfLog(h.selfLogger, slog.LevelWarn, fmt.Sprintf("Dropping log record %q: %v", doc.Message, err))
+			h.drop(orig)
+			return err
+		}
+	}
+
+	if h.minDebugSize > 0 && r.Level < slog.LevelInfo {
+		if data, err := json.Marshal(doc); err == nil && len(data) < h.minDebugSize {
+			return nil
+		}
+	}
+
+	if h.fieldStats != nil {
+		h.fieldStats.observe(doc.Fields)
+	}
+
+	index := h.indexFor(ctx, doc)
+	if h.indexBreakers != nil && h.breakerFor(index).IsOpen() {
+		h.drop(orig)
+		return nil
+	}
+
+	if h.dedup != nil && !h.dedup.add(doc, index, r.Level) {
+		return nil
+	}
+
+	err := h.send(doc, index, r.Level)
+	if errors.Is(err, ErrQueueFull) {
+		h.drop(orig)
+	}
+	return err
+}
+
+// send delivers a formatted document to the batcher or indexes it directly.
+func (h *Handler) send(doc *LogDocument, index string, level slog.Level) error {
+	var id string
+	if h.upsertKey != nil {
+		id = h.upsertKey(doc)
+	}
+	if id == "" && h.retry != nil && h.retry.attempts > 1 && h.retry.idempotent {
+		id = retryID()
+	}
+
+	if h.dryRun != nil {
+		return h.writeDryRun(doc)
+	}
+
+	if h.file != nil {
+		return h.writeFile(doc)
+	}
+
+	if h.batcher != nil {
+		if err := h.batcher.add(BulkItem{Index: index, ID: id, Document: doc}); err != nil {
+			return err
+		}
+		if h.flushLevel != nil && level >= *h.flushLevel {
+			h.batcher.flush(FlushReasonLevel)
+		}
+		return nil
+	}
+
+	// Fire-and-forget indexing
+	h.state.pending.Add(1)
+	h.state.pendingDocs.Add(1)
+	job := func() {
+		defer h.state.pending.Done()
+		defer h.state.pendingDocs.Add(-1)
+		err := h.index(index, id, doc)
+		var unexpected *UnexpectedResultError
+		if errors.As(err, &unexpected) {
+			// The cluster answered, so this is not an outage for the breaker
+			h.rejectResult(BulkItem{Index: index, ID: id, Document: doc}, unexpected)
+			err = nil
+		}
+		h.recordResult(index, err)
+	}
+
+	if h.workers == nil {
+		go job()
+		return nil
+	}
+	if h.overflow == OverflowReject {
+		queued, closed := h.workers.trySubmit(job)
+		if !queued {
+			h.state.pending.Done()
+			h.state.pendingDocs.Add(-1)
+			if !closed {
+				// The caller counts the drop; it holds the record for onDrop
+				return ErrQueueFull
+			}
+			h.state.dropped.Add(1)
+		}
+		return nil
+	}
+	if !h.workers.submit(job) {
+		// The handler was closed; nothing will send this record
+		h.state.pending.Done()
+		h.state.pendingDocs.Add(-1)
+		h.state.dropped.Add(1)
+	}
+	return nil
+}
+
+// rejectResult counts a document whose index response failed validation as
+// dropped and reports it to the batch error handler, if any.
+func (h *Handler) rejectResult(item BulkItem, err *UnexpectedResultError) {
+	h.state.dropped.Add(1)
+	if h.onBatchError != nil {
+		h.onBatchError([]FailedItem{{Item: item, Status: http.StatusOK, Reason: err.Error()}})
+		return
+	}
+	selfLog(h.selfLogger, slog.LevelWarn, err.Error())
+}
+
+// writeFile appends a document to the NDJSON file sink.
+func (h *Handler) writeFile(doc *LogDocument) error {
+	if h.ingestTimestamp {
+		doc.stampIngestTime()
+	}
+	data, err := h.client.encode(doc)
+	if err != nil {
+		return err
+	}
+	return h.file.write(append(data, '\n'))
+}
+
+// writeDryRun writes a document to the dry-run writer, indented if configured.
+func (h *Handler) writeDryRun(doc *LogDocument) error {
+	data, err := h.client.encode(doc)
+	if err != nil {
+		return err
+	}
+	if h.prettyPrint {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err == nil {
+			data = indented.Bytes()
+		}
+	}
+	return h.dryRun.write(append(data, '\n'))
+}
+
+// index writes a single document, creating its index first if configured.
+func (h *Handler) index(index, id string, doc *LogDocument) error {
+	if h.indices != nil {
+		if err := h.indices.ensure(h.state.ctx, index); err != nil {
+			return err
+		}
+	}
+	if h.ingestTimestamp {
+		doc.stampIngestTime()
+	}
+
+	send := func() error {
+		if id != "" {
+			return h.client.IndexWithID(h.state.ctx, index, id, doc)
+		}
+		return h.client.IndexTo(h.state.ctx, index, doc)
+	}
+	var err error
+	if h.retry != nil {
+		err = h.retry.do(h.state.ctx, send)
+	} else {
+		err = send()
+	}
+
+	var notFound *IndexNotFoundError
+	if h.indices != nil && errors.As(err, &notFound) {
+		h.indices.invalidate(index)
+	}
+	return err
+}
+
+// emit sends a document whose record was held back, such as a dedup summary.
+func (h *Handler) emit(doc *LogDocument, index string, level slog.Level) {
+	err := h.send(doc, index, level)
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		h.state.dropped.Add(1)
+	case err != nil:
+		h.breakerFor(index).RecordFailure(err)
+	}
+}
+
+// sampled reports whether a record at level is kept under cfg.SampleRates.
+func (h *Handler) sampled(level slog.Level) bool {
+	rate, ok := h.cfg.SampleRates[NormalizeLevel(level)]
+	return !ok || rate >= 1 || rand.Float64() < rate
+}
+
+// withHandlerAttrs returns a copy of r whose attrs are the handler's attrs
+// followed by the record's own attrs nested under the handler's groups.
+func (h *Handler) withHandlerAttrs(r slog.Record) slog.Record {
+	if len(h.attrs) == 0 && len(h.groups) == 0 {
+		return r
+	}
+
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	nr.AddAttrs(h.attrs...)
+	if r.NumAttrs() > 0 {
+		attrs := make([]slog.Attr, 0, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = append(attrs, a)
+			return true
+		})
+		nr.AddAttrs(wrapInGroups(h.groups, attrs)...)
+	}
+	return nr
+}
+
+// wrapInGroups nests attrs under the given groups, outermost first.
+func wrapInGroups(groups []string, attrs []slog.Attr) []slog.Attr {
+	for i := len(groups) - 1; i >= 0; i-- {
+		attrs = []slog.Attr{{Key: groups[i], Value: slog.GroupValue(attrs...)}}
+	}
+	return attrs
+}
+
+// format builds the v2.0 document for a record and applies handler options.
+func (h *Handler) format(ctx context.Context, r slog.Record) *LogDocument {
+	if h.replaceAttr != nil {
+		r = replaceAttrs(r, h.replaceAttr)
+	}
+	if h.numericDurations || h.epochTimes {
+		r = numericTimeAttrs(r, h.numericDurations, h.epochTimes)
+	}
+
+	doc := formatLogDocument(ctx, r, h.cfg, h)
+
+	if h.topLevelCorrelations {
+		promoteCorrelations(doc, GetCorrelations(ctx))
+	}
+
+	if h.maxClockSkew > 0 {
+		now := time.Now()
+		if skew := r.Time.Sub(now); skew > h.maxClockSkew {
+			doc.Timestamp = now.UTC().Format("2006-01-02T15:04:05.000Z")
+			if doc.Fields == nil {
+				doc.Fields = make(map[string]interface{}, 1)
+			}
+			doc.Fields["_clock_skew_ms"] = skew.Milliseconds()
+		}
+	}
+
+	if h.levelField != "" {
+		if level, ok := doc.Fields[h.levelField].(string); ok {
+			level = strings.ToLower(level)
+			if level == "warn" {
+				level = "warning"
+			}
+			if levelRank(level) > 0 {
+				doc.Level = level
+				delete(doc.Fields, h.levelField)
+			}
+		}
+	}
+
+	retention, hasRetention := h.retentionDays[doc.Level]
+
+	if alias, ok := h.levelAliases[doc.Level]; ok {
+		doc.canonicalLevel = doc.Level
+		doc.Level = alias
+	}
+
+	if doc.Message == "" && h.emptyMessage != nil {
+		doc.Message = h.emptyMessage(r)
+	}
+
+	if h.shortenFunc != nil && doc.Source.FuncName != nil {
+		full := *doc.Source.FuncName
+		short := h.shortenFunc(full)
+		doc.Source.FuncName = &short
+		if doc.Source.Logger == full {
+			doc.Source.Logger = short
+		}
+	}
+
+	if h.multiline != 0 {
+		splitMultilineMessage(doc, h.multiline)
+	}
+
+	if h.messageTemplates {
+		if template, ok := messageTemplate(doc.Message); ok {
+			if doc.Fields == nil {
+				doc.Fields = make(map[string]interface{}, 1)
+			}
+			if _, exists := doc.Fields["message_template"]; !exists {
+				doc.Fields["message_template"] = template
+			}
+		}
+	}
+
+	if h.schemaVersion != "" {
+		doc.SchemaVersion = h.schemaVersion
+	}
+
+	if h.threadID != nil {
+		doc.Process.Thread = h.threadID()
+	}
+
+	if h.requireOperationID && doc.OperationID == nil {
+		h.ensureOperationID(doc)
+	}
+
+	if len(h.fieldRenames) > 0 && doc.Fields != nil {
+		renameFields(doc.Fields, h.fieldRenames)
+	}
+
+	if len(h.hashedFields) > 0 && doc.Fields != nil {
+		hashFields(doc.Fields, h.hashedFields, h.hashSalt, "")
+	}
+
+	if h.allowedFields != nil && doc.Fields != nil {
+		filterFields(doc.Fields, h.allowedFields, "")
+	}
+
+	if hasRetention {
+		if doc.Fields == nil {
+			doc.Fields = make(map[string]interface{}, 1)
+		}
+		doc.Fields["retention_days"] = retention
+	}
+
+	if len(h.goBuildFields) > 0 {
+		if doc.Fields == nil {
+			doc.Fields = make(map[string]interface{}, len(h.goBuildFields))
+		}
+		for k, v := range h.goBuildFields {
+			if _, exists := doc.Fields[k]; !exists {
+				doc.Fields[k] = v
+			}
+		}
+	}
+
+	if len(h.fieldTypes) > 0 && doc.Fields != nil {
+		coerceFieldTypes(doc.Fields, h.fieldTypes)
+	}
+
+	if h.ipV4Mask != nil && doc.Fields != nil {
+		obfuscateIPs(doc.Fields, h.ipV4Mask, h.ipV6Mask)
+	}
+
+	var suffixed map[string]string
+	if h.typeSuffixes != nil && doc.Fields != nil {
+		suffixed = suffixFieldTypes(doc.Fields, h.typeSuffixes)
+	}
+
+	if h.sanitizeKeys && doc.Fields != nil {
+		doc.Fields = sanitizeFieldKeys(doc.Fields)
+	}
+
+	if h.maxFields > 0 && len(doc.Fields) > h.maxFields {
+		order := attrKeyOrder(r)
+		for i, k := range order {
+			if renamed, ok := h.fieldRenames[k]; ok {
+				k = renamed
+			}
+			if renamed, ok := suffixed[k]; ok {
+				k = renamed
+			}
+			if h.sanitizeKeys {
+				k = sanitizeFieldKey(k)
+			}
+			order[i] = k
+		}
+		capFieldCount(doc.Fields, order, h.maxFields)
+	}
+
+	if h.defaultFields != nil && len(doc.Fields) == 0 {
+		doc.Fields = make(map[string]interface{}, len(h.defaultFields))
+		for k, v := range h.defaultFields {
+			doc.Fields[k] = v
+		}
+		doc.keepEmptyFields = true
+	}
+
+	if h.fieldsAsJSON && (len(doc.Fields) > 0 || doc.keepEmptyFields) {
+		if data, err := json.Marshal(doc.Fields); err == nil {
+			fieldsJSON := string(data)
+			if doc.Fields == nil {
+				fieldsJSON = "{}"
+			}
+			doc.FieldsJSON = &fieldsJSON
+			doc.Fields = nil
+			doc.keepEmptyFields = false
+		}
+	}
+
+	return doc
+}
+
+// splitMultilineMessage keeps the first line of doc.Message and moves the rest
+// to where mode says.
+func splitMultilineMessage(doc *LogDocument, mode MultilineMode) {
+	first, rest, found := strings.Cut(doc.Message, "\n")
+	if !found {
+		return
+	}
+	doc.Message = strings.TrimSuffix(first, "\r")
+	if mode == MultilineException && doc.Exception == nil {
+		doc.Exception = &rest
+		return
+	}
+	if doc.Fields == nil {
+		doc.Fields = make(map[string]interface{}, 1)
+	}
+	doc.Fields["message_detail"] = rest
+}
+
+// ensureOperationID sets OperationID from an "operation_id" field, or generates one.
+func (h *Handler) ensureOperationID(doc *LogDocument) {
+	if opID, ok := doc.Fields["operation_id"].(string); ok && opID != "" {
+		delete(doc.Fields, "operation_id")
+		doc.OperationID = &opID
+		return
+	}
+
+	opID := generateUUID()
+	doc.OperationID = &opID
+	if h.warnOperationID {
+		h.state.opIDWarning.Do(func() {
+			selfLog(h.selfLogger, slog.LevelWarn, "Log record has no operation_id, generating one; wrap requests with WithOperation")
+		})
+	}
+}
+
+// indexFor returns the target index for a document.
+// An empty result means the client's configured index.
+func (h *Handler) indexFor(ctx context.Context, doc *LogDocument) string {
+	for _, resolve := range h.indexResolvers {
+		if index := resolve(ctx, doc); index != "" {
+			return index
+		}
+	}
+	return h.defaultIndex()
+}
+
+// defaultIndex returns the index set by SetIndex or WithBuildIndexSuffix, or
+// "" for the client's index.
+func (h *Handler) defaultIndex() string {
+	h.state.indexMu.RLock()
+	defer h.state.indexMu.RUnlock()
+	return h.state.index
+}
+
+// drop reports a record discarded without being sent.
+func (h *Handler) drop(r slog.Record) {
+	h.state.dropped.Add(1)
+	if h.onDrop != nil {
+		h.onDrop(r)
+	}
+}
+
+// recordResult updates the circuit breaker with the outcome of a send to index.
+func (h *Handler) recordResult(index string, err error) {
+	recordResult(h.breakerFor(index), h.onReconnect, err)
+}
+
+// breakerFor returns the circuit breaker guarding sends to index ("" for the
+// client's index).
+func (h *Handler) breakerFor(index string) *CircuitBreaker {
+	if h.indexBreakers == nil {
+		return h.cb
+	}
+	if index == "" {
+		index = h.client.IndexName()
+	}
+	return h.indexBreakers.get(index)
+}
+
+// OpenIndices returns the sorted names of indices whose circuit breaker is
+// open with WithPerIndexCircuitBreaker, i.e. those currently paused. It
+// returns nil when the handler uses a single breaker.
+func (h *Handler) OpenIndices() []string {
+	if h.indexBreakers == nil {
+		return nil
+	}
+	return h.indexBreakers.open()
+}
+
+// recordResult updates cb with the outcome of a send, firing onReconnect when
+// the send closes an open breaker.
+func recordResult(cb *CircuitBreaker, onReconnect func(), err error) {
+	if err != nil {
+		cb.RecordFailure(err)
+	} else if cb.recordSuccess() && onReconnect != nil {
+		// Off the send path; the hook may do slow work like replaying a fallback file
+		go onReconnect()
+	}
+}
+
+// QueueDepth reports how many records are waiting to be sent (buffered, queued
+// for a worker or in flight) and the capacity of the queue that bounds them:
+// the worker queue size with WithAsyncWorkers, the batch size with
+// WithBatching, or 0 when sends are unbounded goroutines. It does not lock, so
+// it is cheap enough to poll for autoscaling metrics alongside Dropped.
+func (h *Handler) QueueDepth() (length, capacity int) {
+	length = int(h.state.pendingDocs.Load())
+	if h.batcher != nil {
+		length += h.batcher.depth()
+		capacity = h.batchSize
+	}
+	if h.workers != nil {
+		capacity = cap(h.workers.jobs)
+	}
+	return length, capacity
+}
+
+// Flush sends any buffered records and waits for in-flight sends to finish.
+func (h *Handler) Flush() {
+	if h.dedup != nil {
+		h.dedup.flush()
+	}
+	if h.batcher != nil {
+		h.batcher.flush(FlushReasonManual)
+	}
+	h.state.pending.Wait()
+}
+
+// LastFlushReason reports which trigger sent the most recent batch, for
+// debugging batching settings. It is FlushReasonNone without batching or
+// before the first batch is sent.
+func (h *Handler) LastFlushReason() FlushReason {
+	if h.batcher == nil {
+		return FlushReasonNone
+	}
+	return FlushReason(h.batcher.lastReason.Load())
+}
+
+// Close flushes remaining records and stops background batching.
+// Handlers derived with WithAttrs or WithGroup share the same batcher,
+// so Close only needs to be called once.
+//
+// Close waits at most the shutdown timeout (see WithShutdownTimeout). If records
+// are still unsent when it expires, in-flight requests are aborted, the records
+// are counted as dropped and a *ShutdownTimeoutError is returned. The file from
+// WithNDJSONFile is closed either way.
+func (h *Handler) Close() error {
+	if h.leakGuard != nil {
+		h.leakGuard.disarm()
+	}
+
+	var closeErr error
+	done := make(chan struct{})
+	go func() {
+		if h.dedup != nil {
+			h.dedup.flush()
+		}
+		if h.batcher != nil {
+			h.batcher.close()
+		}
+		h.state.pending.Wait()
+		if h.workers != nil {
+			h.workers.close()
+		}
+		if h.file != nil {
+			closeErr = h.file.close()
+		}
+		close(done)
+	}()
+
+	if h.shutdownTimeout <= 0 {
+		<-done
+		return closeErr
+	}
+
+	timer := time.NewTimer(h.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return closeErr
+	case <-timer.C:
+		undrained := int(h.state.pendingDocs.Load())
+		if h.batcher != nil {
+			undrained += h.batcher.undrained()
+		}
+		h.state.dropped.Add(int64(undrained))
+		h.state.cancel()
+		if h.file != nil {
+			// Writes still in flight fail rather than keep the file open
+			h.file.close()
+		}
+		return &ShutdownTimeoutError{Undrained: undrained, Timeout: h.shutdownTimeout}
+	}
+}
+
+// SetIndex redirects subsequent records that no index resolver routes
+// elsewhere to name. Handlers derived with WithAttrs or WithGroup are
+// redirected too; other handlers sharing the client are not.
+func (h *Handler) SetIndex(name string) {
+	h.state.indexMu.Lock()
+	defer h.state.indexMu.Unlock()
+	h.state.index = name
+}
+
+// Reload reloads the configuration from the environment (see LoadConfig) and
+// points the handler's client at the new host, credentials, timeout, index and
+// data stream mode, so long-running daemons pick up a rotated secret or
+// ConfigMap change without restarting. Buffered and in-flight records are sent
+// with the old settings first. An index set with SetIndex is kept unless the
+// configured index changed; WithBuildIndexSuffix is applied to the new one.
+// Document metadata such as application and component is not reloaded. If the
+// new configuration is invalid, nothing changes.
+func (h *Handler) Reload() error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	h.state.reloadMu.Lock()
+	defer h.state.reloadMu.Unlock()
+	h.Flush()
+	if err := h.client.Reconfigure(cfg); err != nil {
+		return err
+	}
+
+	h.state.indexMu.Lock()
+	defer h.state.indexMu.Unlock()
+	if cfg.Index != h.state.configIndex {
+		h.state.configIndex = cfg.Index
+		h.state.index = ""
+		if h.indexSuffix != "" {
+			h.state.index = cfg.Index + h.indexSuffix
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of records discarded without being sent.
+func (h *Handler) Dropped() int64 {
+	return h.state.dropped.Load()
+}
+
+// WithAttrs returns a new Handler with additional attributes.
+// The attributes are nested under any groups opened with WithGroup.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	attrs = wrapInGroups(h.groups, attrs)
+
+	newHandler := *h
+	newHandler.attrs = make([]slog.Attr, len(h.attrs)+len(attrs))
+	copy(newHandler.attrs, h.attrs)
+	copy(newHandler.attrs[len(h.attrs):], attrs)
+	return &newHandler
+}
+
+// WithGroup returns a new Handler with a group name.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	newHandler := *h
+	newHandler.groups = make([]string, len(h.groups)+1)
+	copy(newHandler.groups, h.groups)
+	newHandler.groups[len(h.groups)] = name
+	return &newHandler
+}
@@ -0,0 +1,79 @@
+package devlogs
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// IndexResolver picks the target index for a document.
+// Returning an empty string defers to the next resolver, and finally to the
+// client's configured index.
+type IndexResolver func(ctx context.Context, doc *LogDocument) string
+
+// FirstIndexResolver composes resolvers, returning the first non-empty index.
+func FirstIndexResolver(resolvers ...IndexResolver) IndexResolver {
+	return func(ctx context.Context, doc *LogDocument) string {
+		for _, resolve := range resolvers {
+			if resolve == nil {
+				continue
+			}
+			if index := resolve(ctx, doc); index != "" {
+				return index
+			}
+		}
+		return ""
+	}
+}
+
+// LevelIndexResolver routes documents at or above atLevel to index. It compares
+// the devlogs level, so it is unaffected by WithLevelAlias.
+func LevelIndexResolver(index string, atLevel slog.Level) IndexResolver {
+	threshold := levelRank(NormalizeLevel(atLevel))
+	return func(_ context.Context, doc *LogDocument) string {
+		if doc.levelRank() >= threshold {
+			return index
+		}
+		return ""
+	}
+}
+
+// AreaIndexResolver routes documents to prefix + area.
+// Documents without an area are left to the next resolver.
+func AreaIndexResolver(prefix string) IndexResolver {
+	return func(_ context.Context, doc *LogDocument) string {
+		if doc.Area == nil || *doc.Area == "" {
+			return ""
+		}
+		return prefix + *doc.Area
+	}
+}
+
+// DateIndexResolver routes documents to prefix + the document date formatted
+// with layout, e.g. DateIndexResolver("devlogs-", "2006.01.02").
+func DateIndexResolver(prefix, layout string) IndexResolver {
+	return func(_ context.Context, doc *LogDocument) string {
+		t, err := time.Parse("2006-01-02T15:04:05.000Z", doc.Timestamp)
+		if err != nil {
+			t = time.Now().UTC()
+		}
+		return prefix + t.Format(layout)
+	}
+}
+
+// sanitizeIndexName makes s valid as (part of) an OpenSearch index name:
+// lowercase, only letters, digits, '.', '_' and '-', not starting with '-',
+// '_' or '.'.
+func sanitizeIndexName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, s)
+	return strings.TrimLeft(s, "-_.")
+}
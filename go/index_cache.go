@@ -0,0 +1,59 @@
+package devlogs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// indexCache remembers which indices are known to exist so EnsureIndex runs at
+// most once per index per ttl.
+type indexCache struct {
+	client *Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	checked map[string]time.Time
+}
+
+func newIndexCache(client *Client, ttl time.Duration) *indexCache {
+	return &indexCache{
+		client:  client,
+		ttl:     ttl,
+		checked: make(map[string]time.Time),
+	}
+}
+
+// ensure creates index if needed, skipping the check while a previous one is fresh.
+func (c *indexCache) ensure(ctx context.Context, index string) error {
+	if index == "" {
+		index = c.client.IndexName()
+	}
+
+	c.mu.Lock()
+	checkedAt, ok := c.checked[index]
+	c.mu.Unlock()
+	if ok && time.Since(checkedAt) < c.ttl {
+		return nil
+	}
+
+	if err := c.client.EnsureIndex(ctx, index); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.checked[index] = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// invalidate forgets index so the next send checks it again, e.g. after the
+// index was deleted.
+func (c *indexCache) invalidate(index string) {
+	if index == "" {
+		index = c.client.IndexName()
+	}
+	c.mu.Lock()
+	delete(c.checked, index)
+	c.mu.Unlock()
+}
@@ -0,0 +1,119 @@
+package devlogs
+
+import "net/http"
+
+// middlewareConfig holds the settings shared by the HTTP middleware constructors.
+type middlewareConfig struct {
+	// headerFields maps request header names to the field names they are logged as
+	headerFields map[string]string
+
+	// writeOperationID adds the operation ID to the response before the handler runs (nil disables)
+	writeOperationID func(w http.ResponseWriter, operationID string)
+
+	// operationIDHeader is read for an incoming operation ID and echoed in the response ("" disables)
+	operationIDHeader string
+}
+
+// DefaultOperationIDHeader is the header WithOperationIDHeaderEcho uses when
+// given an empty name.
+const DefaultOperationIDHeader = "X-Operation-ID"
+
+// MiddlewareOption configures the middleware built by NewMiddleware.
+type MiddlewareOption func(*middlewareConfig)
+
+// WithHeaderFields attaches the given request headers as fields to every
+// record logged with the request context. headerToField maps header names to
+// field names; headers missing from a request are skipped.
+func WithHeaderFields(headerToField map[string]string) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.headerFields = headerToField
+	}
+}
+
+// WithOperationIDInResponse calls write with the request's operation ID before
+// the wrapped handler runs, so the response can carry it and support engineers
+// can match an error a user reports to its logs. Use OperationIDTrailer to send
+// it as an HTTP trailer, or a custom function for framework-specific locations
+// such as a header or a value the handler adds to its error body.
+func WithOperationIDInResponse(write func(w http.ResponseWriter, operationID string)) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.writeOperationID = write
+	}
+}
+
+// WithOperationIDHeaderEcho makes the middleware take the operation ID from
+// the request header name, if present, so an ID set by a client or upstream
+// service carries through, and always set the resolved ID, incoming or
+// generated, as the same response header before the wrapped handler runs.
+// Clients and load balancers can then log it for cross-system correlation. An
+// empty name uses DefaultOperationIDHeader.
+func WithOperationIDHeaderEcho(name string) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		if name == "" {
+			name = DefaultOperationIDHeader
+		}
+		cfg.operationIDHeader = name
+	}
+}
+
+// OperationIDTrailer returns a WithOperationIDInResponse writer that sends the
+// operation ID as the HTTP trailer name, e.g. "X-Operation-ID", after the body.
+// Declaring the trailer makes the response use chunked encoding.
+func OperationIDTrailer(name string) func(w http.ResponseWriter, operationID string) {
+	return func(w http.ResponseWriter, operationID string) {
+		w.Header().Add("Trailer", name)
+		w.Header().Set(http.TrailerPrefix+name, operationID)
+	}
+}
+
+// Middleware wraps next so each request runs as its own operation: the
+// request context carries a new operation_id, which every record logged with
+// it (e.g. slog.InfoContext(r.Context(), ...)) is tagged with.
+func Middleware(next http.Handler) http.Handler {
+	return NewMiddleware()(next)
+}
+
+// MiddlewareWithFields is like Middleware, and also attaches the configured
+// request headers as fields to every record logged with the request context.
+// headerToField maps header names to field names, e.g.
+//
+//	devlogs.MiddlewareWithFields(map[string]string{
+//		"X-Tenant":   "tenant",
+//		"User-Agent": "user_agent",
+//	})(mux)
+//
+// Headers missing from a request are skipped.
+func MiddlewareWithFields(headerToField map[string]string) func(http.Handler) http.Handler {
+	return NewMiddleware(WithHeaderFields(headerToField))
+}
+
+// NewMiddleware builds an HTTP middleware like Middleware with options.
+func NewMiddleware(opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	var cfg middlewareConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var operationID string
+			if cfg.operationIDHeader != "" {
+				operationID = r.Header.Get(cfg.operationIDHeader)
+			}
+			ctx := WithOperationID(r.Context(), operationID)
+			for header, field := range cfg.headerFields {
+				if value := r.Header.Get(header); value != "" {
+					ctx = WithCorrelation(ctx, field, value)
+				}
+			}
+			if cfg.operationIDHeader != "" {
+				// Set upfront; headers are sent as soon as the handler writes the body
+				w.Header().Set(cfg.operationIDHeader, GetOperationID(ctx))
+			}
+			if cfg.writeOperationID != nil {
+				cfg.writeOperationID(w, GetOperationID(ctx))
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package devlogs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mirror writes a concise text line per document, for reading logs on the console.
+type mirror struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// write formats doc as "timestamp LEVEL message key=value ..." and writes it.
+// Nested groups are flattened to dotted keys; keys are sorted.
+func (m *mirror) write(doc *LogDocument) {
+	var buf bytes.Buffer
+	buf.WriteString(doc.Timestamp)
+	buf.WriteByte(' ')
+	buf.WriteString(strings.ToUpper(doc.Level))
+	buf.WriteByte(' ')
+	buf.WriteString(doc.Message)
+	writeMirrorFields(&buf, "", doc.Fields)
+	buf.WriteByte('\n')
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.w.Write(buf.Bytes())
+}
+
+// writeMirrorFields appends " key=value" pairs for fields in sorted key order.
+func writeMirrorFields(buf *bytes.Buffer, prefix string, fields map[string]interface{}) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if nested, ok := fields[k].(map[string]interface{}); ok {
+			writeMirrorFields(buf, prefix+k+".", nested)
+			continue
+		}
+		value := fmt.Sprint(fields[k])
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(prefix + k)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+	}
+}
+
+// dryRunWriter serializes dry-run output so documents do not interleave.
+type dryRunWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (d *dryRunWriter) write(data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.w.Write(data)
+	return err
+}
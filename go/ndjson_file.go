@@ -0,0 +1,104 @@
+package devlogs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ndjsonFile appends one JSON document per line to a file, rotating it by size.
+// This is the format file shippers such as Filebeat and Fluent Bit expect.
+type ndjsonFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openNDJSONFile(path string, maxBytes int64, maxBackups int) (*ndjsonFile, error) {
+	nf := &ndjsonFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := nf.open(); err != nil {
+		return nil, err
+	}
+	return nf, nil
+}
+
+// open opens the current file for appending. Caller holds nf.mu or owns nf.
+func (nf *ndjsonFile) open() error {
+	f, err := os.OpenFile(nf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", nf.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", nf.path, err)
+	}
+	nf.f = f
+	nf.size = info.Size()
+	return nil
+}
+
+// write appends line, which must end in a newline, rotating first if the file
+// would grow past maxBytes.
+func (nf *ndjsonFile) write(line []byte) error {
+	nf.mu.Lock()
+	defer nf.mu.Unlock()
+
+	if nf.f == nil {
+		return fmt.Errorf("log file %s is closed", nf.path)
+	}
+	if nf.maxBytes > 0 && nf.size > 0 && nf.size+int64(len(line)) > nf.maxBytes {
+		if err := nf.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := nf.f.Write(line)
+	nf.size += int64(n)
+	return err
+}
+
+// rotate shifts path.N to path.N+1, moves the current file to path.1 and
+// reopens path. Backups beyond maxBackups are removed. With no backups the file
+// is truncated in place, so a shipper tailing it keeps the same file. Caller
+// holds nf.mu.
+func (nf *ndjsonFile) rotate() error {
+	if nf.maxBackups < 1 {
+		if err := nf.f.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate log file %s: %w", nf.path, err)
+		}
+		nf.size = 0
+		return nil
+	}
+
+	if err := nf.f.Close(); err != nil {
+		return err
+	}
+	nf.f = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", nf.path, nf.maxBackups))
+	for i := nf.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", nf.path, i), fmt.Sprintf("%s.%d", nf.path, i+1))
+	}
+	if err := os.Rename(nf.path, nf.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log file %s: %w", nf.path, err)
+	}
+
+	return nf.open()
+}
+
+// close closes the file. Further writes fail.
+func (nf *ndjsonFile) close() error {
+	nf.mu.Lock()
+	defer nf.mu.Unlock()
+	if nf.f == nil {
+		return nil
+	}
+	err := nf.f.Close()
+	nf.f = nil
+	return err
+}
@@ -0,0 +1,54 @@
+package devlogs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// retryPolicy re-sends requests that failed with a transient connection error.
+type retryPolicy struct {
+	// attempts is the total number of tries, including the first
+	attempts int
+	// backoff is the wait before the first retry; it doubles for each later one
+	backoff time.Duration
+	// idempotent gives documents without an _id a random _id before the first
+	// attempt, so a retry of a request that actually succeeded overwrites
+	// instead of duplicating
+	idempotent bool
+}
+
+// do calls send until it succeeds, fails permanently, or attempts run out.
+func (p *retryPolicy) do(ctx context.Context, send func() error) error {
+	err := send()
+	wait := p.backoff
+	for attempt := 1; attempt < p.attempts && retryable(err); attempt++ {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait *= 2
+		err = send()
+	}
+	return err
+}
+
+// retryable reports whether err is a transient connection failure. Canceled
+// requests (e.g. at shutdown) and errors the server returned on purpose, such
+// as auth or query errors, are not retried.
+func retryable(err error) bool {
+	var connErr *ConnectionError
+	return errors.As(err, &connErr) && !connErr.IsCanceled()
+}
+
+// retryID returns a random _id for a document, generated once before its
+// first attempt. Unlike a content hash, identical records logged in the same
+// millisecond get distinct IDs and cannot overwrite each other.
+func retryID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
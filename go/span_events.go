@@ -0,0 +1,50 @@
+package devlogs
+
+import "context"
+
+// SpanEventRecorder adds log records as events on the trace span in a context.
+// It keeps devlogs free of an OpenTelemetry dependency; an implementation
+// using go.opentelemetry.io/otel/trace looks like:
+//
+//	type otelSpanEvents struct{}
+//
+//	func (otelSpanEvents) AddEvent(ctx context.Context, name string, attrs map[string]interface{}) bool {
+//		span := trace.SpanFromContext(ctx)
+//		if !span.IsRecording() {
+//			return false
+//		}
+//		kvs := make([]attribute.KeyValue, 0, len(attrs))
+//		for k, v := range attrs {
+//			kvs = append(kvs, attribute.String(k, fmt.Sprint(v)))
+//		}
+//		span.AddEvent(name, trace.WithAttributes(kvs...))
+//		return true
+//	}
+type SpanEventRecorder interface {
+	// AddEvent records an event named name on the span in ctx and reports
+	// whether ctx carried a recording span.
+	AddEvent(ctx context.Context, name string, attrs map[string]interface{}) bool
+}
+
+// spanEventAttrs returns the attributes of a span event for doc: its level,
+// operation ID and fields, with nested groups flattened to dotted keys.
+func spanEventAttrs(doc *LogDocument) map[string]interface{} {
+	attrs := make(map[string]interface{}, len(doc.Fields)+2)
+	attrs["level"] = doc.Level
+	if doc.OperationID != nil {
+		attrs["operation_id"] = *doc.OperationID
+	}
+	flattenFields(attrs, "", doc.Fields)
+	return attrs
+}
+
+// flattenFields copies fields into out with nested groups as dotted keys.
+func flattenFields(out map[string]interface{}, prefix string, fields map[string]interface{}) {
+	for k, v := range fields {
+		if nested, ok := v.(map[string]interface{}); ok {
+			flattenFields(out, prefix+k+".", nested)
+			continue
+		}
+		out[prefix+k] = v
+	}
+}
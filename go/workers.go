@@ -0,0 +1,72 @@
+package devlogs
+
+import "sync"
+
+// workerPool runs submitted jobs on a fixed number of long-lived goroutines.
+type workerPool struct {
+	jobs     chan func()
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newWorkerPool starts n workers reading from a queue of queueSize jobs.
+func newWorkerPool(n, queueSize int) *workerPool {
+	p := &workerPool{
+		jobs: make(chan func(), queueSize),
+		stop: make(chan struct{}),
+	}
+	for i := 0; i < n; i++ {
+		go p.run()
+	}
+	return p
+}
+
+func (p *workerPool) run() {
+	for {
+		select {
+		case job := <-p.jobs:
+			job()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// submit queues job, blocking while the queue is full. It reports false if the
+// pool has been closed.
+func (p *workerPool) submit(job func()) bool {
+	select {
+	case <-p.stop:
+		return false
+	default:
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// trySubmit queues job without blocking. It reports false if the queue is full
+// or the pool has been closed, and closed for the latter.
+func (p *workerPool) trySubmit(job func()) (queued, closed bool) {
+	select {
+	case <-p.stop:
+		return false, true
+	default:
+	}
+	select {
+	case p.jobs <- job:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// close stops the workers. Callers must wait for queued jobs first.
+func (p *workerPool) close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}